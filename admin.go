@@ -0,0 +1,158 @@
+package cachet
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// MonitorStatus is a snapshot of a running monitor, served by the admin api
+type MonitorStatus struct {
+	Name         string   `json:"name"`
+	Type         string   `json:"type"`
+	Description  []string `json:"description"`
+	Paused       bool     `json:"paused"`
+	History      []bool   `json:"history"`
+	LagHistory   []int64  `json:"lag_history"`
+	FailureRatio float32  `json:"failure_ratio"`
+	// Incident is set while an incident is open, IncidentID once the backend created it
+	Incident       bool   `json:"incident"`
+	IncidentID     int    `json:"incident_id,omitempty"`
+	LastFailReason string `json:"last_fail_reason,omitempty"`
+}
+
+// GetStatus returns a snapshot of the monitor's state
+func GetStatus(iface MonitorInterface) MonitorStatus {
+	mon := iface.GetMonitor()
+	description := iface.Describe()
+
+	mon.mu.Lock()
+	defer mon.mu.Unlock()
+
+	status := MonitorStatus{
+		Name:           mon.Name,
+		Type:           mon.Type,
+		Description:    description,
+		Paused:         mon.paused,
+		History:        append([]bool{}, mon.history...),
+		LagHistory:     append([]int64{}, mon.lagHistory...),
+		LastFailReason: mon.lastFailReason,
+	}
+
+	if len(mon.history) > 0 {
+		numDown := 0
+		for _, up := range mon.history {
+			if !up {
+				numDown++
+			}
+		}
+
+		status.FailureRatio = float32(numDown) / float32(len(mon.history))
+	}
+
+	if mon.incident != nil {
+		status.Incident = true
+		status.IncidentID = mon.incident.ID
+	}
+
+	return status
+}
+
+// adminHandler serves the admin api:
+//
+//	GET  /api/monitors                 list monitors
+//	GET  /api/monitors/NAME            single monitor
+//	POST /api/monitors/NAME/check      trigger an immediate check
+//	POST /api/monitors/NAME/pause      pause checks
+//	POST /api/monitors/NAME/resume     resume checks
+//	POST /api/monitors/NAME/resolve    force-resolve the open incident
+//
+// NAME is path escaped, so names containing / are addressed as eg. web%2Fapi
+func (cfg *CachetMonitor) adminHandler(w http.ResponseWriter, r *http.Request) {
+	if len(cfg.Server.Token) > 0 && r.Header.Get("Authorization") != "Bearer "+cfg.Server.Token {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.EscapedPath(), "/api/monitors"), "/")
+	if len(path) == 0 {
+		if r.Method != "GET" {
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+
+		statuses := []MonitorStatus{}
+		for _, monitor := range cfg.GetMonitors() {
+			statuses = append(statuses, GetStatus(monitor))
+		}
+
+		writeJSON(w, http.StatusOK, statuses)
+		return
+	}
+
+	parts := strings.SplitN(path, "/", 2)
+	name, err := url.PathUnescape(parts[0])
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid monitor name"})
+		return
+	}
+
+	monitor := cfg.findMonitor(name)
+	if monitor == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "monitor not found"})
+		return
+	}
+
+	if len(parts) == 1 {
+		if r.Method != "GET" {
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, GetStatus(monitor))
+		return
+	}
+
+	if r.Method != "POST" {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	mon := monitor.GetMonitor()
+	switch parts[1] {
+	case "check":
+		mon.Trigger()
+	case "pause":
+		mon.Pause()
+	case "resume":
+		mon.Resume()
+	case "resolve":
+		if err := mon.ResolveIncident(); err != nil {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			return
+		}
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown action"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, GetStatus(monitor))
+}
+
+// findMonitor returns the monitor named name, or nil
+func (cfg *CachetMonitor) findMonitor(name string) MonitorInterface {
+	for _, monitor := range cfg.GetMonitors() {
+		if monitor.GetMonitor().Name == name {
+			return monitor
+		}
+	}
+
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,171 @@
+package cachet
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAdminAPI(t *testing.T) {
+	backend := &recordingBackend{}
+	web := newScriptedMonitor(backend, "down", "down", "down")
+	web.Name = "web/api"
+	for range web.results {
+		web.tick(web)
+	}
+
+	dns := newScriptedMonitor(backend)
+	dns.Name = "dns"
+
+	cfg := &CachetMonitor{
+		Server:        ServerConfig{Admin: true, Token: "secret"},
+		StatusBackend: backend,
+		DateFormat:    DefaultTimeFormat,
+		Monitors:      []MonitorInterface{web, dns},
+	}
+	web.config, dns.config = cfg, cfg
+
+	tests := []struct {
+		method, path, token string
+		code                int
+		check               func(MonitorStatus) bool
+	}{
+		{"GET", "/api/monitors", "", http.StatusUnauthorized, nil},
+		{"GET", "/api/monitors", "wrong", http.StatusUnauthorized, nil},
+		{"POST", "/api/monitors", "secret", http.StatusMethodNotAllowed, nil},
+		{"GET", "/api/monitors/missing", "secret", http.StatusNotFound, nil},
+		{"GET", "/api/monitors/web%2Fapi", "secret", http.StatusOK, func(s MonitorStatus) bool {
+			return s.Name == "web/api" && s.Incident && s.IncidentID == 1 && s.LastFailReason == "down" && len(s.History) == 3
+		}},
+		{"GET", "/api/monitors/web%2Fapi/pause", "secret", http.StatusMethodNotAllowed, nil},
+		{"POST", "/api/monitors/web%2Fapi/pause", "secret", http.StatusOK, func(s MonitorStatus) bool { return s.Paused }},
+		{"POST", "/api/monitors/web%2Fapi/resume", "secret", http.StatusOK, func(s MonitorStatus) bool { return !s.Paused }},
+		{"POST", "/api/monitors/web%2Fapi/check", "secret", http.StatusOK, nil},
+		{"POST", "/api/monitors/web%2Fapi/resolve", "secret", http.StatusOK, func(s MonitorStatus) bool { return !s.Incident && s.IncidentID == 0 }},
+		{"POST", "/api/monitors/web%2Fapi/resolve", "secret", http.StatusConflict, nil},
+		{"POST", "/api/monitors/web%2Fapi/restart", "secret", http.StatusNotFound, nil},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.path, nil)
+		if len(test.token) > 0 {
+			req.Header.Set("Authorization", "Bearer "+test.token)
+		}
+
+		w := httptest.NewRecorder()
+		cfg.adminHandler(w, req)
+
+		if w.Code != test.code {
+			t.Errorf("%s %s: expected %d, got %d: %s", test.method, test.path, test.code, w.Code, w.Body)
+			continue
+		}
+
+		if test.check == nil {
+			continue
+		}
+
+		var status MonitorStatus
+		if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil || !test.check(status) {
+			t.Errorf("%s %s: unexpected status %s (%v)", test.method, test.path, w.Body, err)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/api/monitors", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	cfg.adminHandler(w, req)
+
+	var statuses []MonitorStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &statuses); err != nil || len(statuses) != 2 {
+		t.Errorf("expected 2 monitors, got %s (%v)", w.Body, err)
+	}
+
+	if last := backend.actions[len(backend.actions)-1]; last != "resolve" {
+		t.Errorf("expected the incident to be resolved, got %v", backend.actions)
+	}
+}
+
+// blockingMonitor fails its checks once released
+type blockingMonitor struct {
+	AbstractMonitor
+	started, release chan bool
+}
+
+func (monitor *blockingMonitor) test() bool {
+	monitor.started <- true
+	<-monitor.release
+
+	monitor.setFailReason(FailTimeout, "timed out")
+	return false
+}
+
+func TestAdminNotBlockedByCheck(t *testing.T) {
+	monitor := &blockingMonitor{started: make(chan bool), release: make(chan bool)}
+	monitor.Name = "slow"
+	monitor.config = &CachetMonitor{StatusBackend: &recordingBackend{}, DateFormat: DefaultTimeFormat}
+
+	done := make(chan bool)
+	go func() {
+		monitor.tick(monitor)
+		done <- true
+	}()
+	<-monitor.started
+
+	requests := make(chan bool)
+	go func() {
+		GetStatus(monitor)
+		monitor.Pause()
+		monitor.Resume()
+		monitor.ResolveIncident()
+		requests <- true
+	}()
+
+	select {
+	case <-requests:
+	case <-time.After(time.Second):
+		t.Error("status and control requests blocked by the running check")
+	}
+
+	close(monitor.release)
+	<-done
+
+	if status := GetStatus(monitor); status.LastFailReason != "timed out" || len(status.History) != 1 {
+		t.Errorf("unexpected status after the check: %+v", status)
+	}
+}
+
+func TestStatusIncidentNotCreated(t *testing.T) {
+	// the backend failed to create the incident, it is still open
+	monitor := newScriptedMonitor(&recordingBackend{failOpen: 1}, "down", "down", "down")
+	for range monitor.results {
+		monitor.tick(monitor)
+	}
+
+	if status := GetStatus(monitor); !status.Incident || status.IncidentID != 0 {
+		t.Errorf("expected an open incident without id, got %+v", status)
+	}
+}
+
+func TestTriggerBeforeClockStart(t *testing.T) {
+	backend := &recordingBackend{}
+	monitor := newScriptedMonitor(backend, "down")
+	monitor.Interval = 3600
+
+	// a check requested before the monitor runs is kept
+	monitor.Trigger()
+
+	wg := &sync.WaitGroup{}
+	go monitor.ClockStart(monitor.config, monitor, wg)
+
+	for i := 0; i < 100 && len(GetStatus(monitor).History) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	monitor.ClockStop()
+
+	if history := GetStatus(monitor).History; len(history) != 1 {
+		t.Errorf("expected the triggered check to run, got history %v", history)
+	}
+}
@@ -2,20 +2,42 @@ package cachet
 
 import (
 	"bytes"
-	"crypto/tls"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/Sirupsen/logrus"
 )
 
+// CachetAPI is the default StatusBackend
 type CachetAPI struct {
 	URL      string `json:"url"`
 	Token    string `json:"token"`
 	Insecure bool   `json:"insecure"`
+
+	TLSConfig `mapstructure:",squash" yaml:",inline"`
+	Proxy     *ProxyConfig `json:"proxy" yaml:"proxy"`
+
+	// DryRun logs write requests instead of sending them
+	DryRun bool `json:"-" yaml:"-"`
+
+	// client is created once the configuration is validated
+	client *http.Client
+}
+
+// ids handed out to incidents created in dry run mode
+var dryRunIncidentID int32
+
+// Component Cachet data model
+type Component struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
 }
 
 type CachetResponse struct {
@@ -38,48 +60,236 @@ func (api CachetAPI) Ping() error {
 	return nil
 }
 
-// SendMetric adds a data point to a cachet monitor
-func (api CachetAPI) SendMetric(id int, lag int64) {
-	logrus.Debugf("Sending lag metric ID:%d RTT %vms", id, lag)
+// SendMetric adds a data point to a cachet metric
+func (api CachetAPI) SendMetric(id int, value float64) error {
+	logrus.Debugf("Sending metric ID:%d value %v", id, value)
 
 	jsonBytes, _ := json.Marshal(map[string]interface{}{
-		"value":     lag,
+		"value":     value,
 		"timestamp": time.Now().Unix(),
 	})
 
 	resp, _, err := api.NewRequest("POST", "/metrics/"+strconv.Itoa(id)+"/points", jsonBytes)
-	if err != nil || resp.StatusCode != 200 {
-		logrus.Warnf("Could not log metric! ID: %d, err: %v", id, err)
+	if err != nil {
+		return err
 	}
 
-	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("Could not log metric! Received %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// OpenIncident creates the incident, setting the component to partial outage
+// (or major outage, if already in partial outage)
+func (api CachetAPI) OpenIncident(incident *Incident) error {
+	// partial outage
+	incident.ComponentStatus = 3
+
+	if incident.ComponentID > 0 {
+		componentStatus, err := api.GetComponentStatus(incident.ComponentID)
+		if componentStatus == 3 {
+			// major outage
+			incident.ComponentStatus = 4
+		}
+
+		if err != nil {
+			logrus.Warnf("cannot fetch component: %v", err)
+		}
+	}
+
+	jsonBytes, _ := json.Marshal(incident)
+
+	resp, body, err := api.NewRequest("POST", "/incidents", jsonBytes)
+	if err != nil {
+		return err
+	}
+
+	var data struct {
+		ID int `json:"id"`
+	}
+	if err := json.Unmarshal(body.Data, &data); err != nil {
+		return fmt.Errorf("Cannot parse incident body: %v, %v", err, string(body.Data))
+	}
+
+	incident.ID = data.ID
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("Could not create incident!")
+	}
+
+	return nil
+}
+
+// UpdateIncident posts an incident update with the incident's current status, keeping the incident timeline intact
+func (api CachetAPI) UpdateIncident(incident *Incident, message string) error {
+	if incident.ID == 0 {
+		return fmt.Errorf("Cannot update incident which was not created")
+	}
+
+	jsonBytes, _ := json.Marshal(IncidentUpdate{
+		Status:  incident.Status,
+		Message: message,
+	})
+
+	resp, _, err := api.NewRequest("POST", "/incidents/"+strconv.Itoa(incident.ID)+"/updates", jsonBytes)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("Could not create incident update! Received %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// ResolveIncident posts the fixed incident update and sets the component back to operational
+func (api CachetAPI) ResolveIncident(incident *Incident, message string) error {
+	incident.SetFixed()
+	incident.ComponentStatus = 1
+
+	if err := api.UpdateIncident(incident, message); err != nil {
+		return err
+	}
+
+	if incident.ComponentID == 0 {
+		return nil
+	}
+
+	return api.SetComponentStatus(incident.ComponentID, incident.ComponentStatus)
+}
+
+// GetComponentStatus fetches the status of a cachet component
+func (api CachetAPI) GetComponentStatus(id int) (int, error) {
+	resp, body, err := api.NewRequest("GET", "/components/"+strconv.Itoa(id), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	if resp.StatusCode != 200 {
+		return 0, fmt.Errorf("Invalid status code. Received %d", resp.StatusCode)
+	}
+
+	var data struct {
+		Status int `json:"status,string"`
+	}
+	if err := json.Unmarshal(body.Data, &data); err != nil {
+		return 0, fmt.Errorf("Cannot parse component body: %v. Err = %v", string(body.Data), err)
+	}
+
+	return data.Status, nil
+}
+
+// GetComponent fetches a cachet component
+func (api CachetAPI) GetComponent(id int) (Component, error) {
+	var component Component
+
+	resp, body, err := api.NewRequest("GET", "/components/"+strconv.Itoa(id), nil)
+	if err != nil {
+		return component, err
+	}
+
+	if resp.StatusCode != 200 {
+		return component, fmt.Errorf("Invalid status code. Received %d", resp.StatusCode)
+	}
+
+	if err := json.Unmarshal(body.Data, &component); err != nil {
+		return component, fmt.Errorf("Cannot parse component body: %v. Err = %v", string(body.Data), err)
+	}
+
+	return component, nil
+}
+
+// SetComponentStatus updates the status of a cachet component
+func (api CachetAPI) SetComponentStatus(id int, status int) error {
+	jsonBytes, _ := json.Marshal(map[string]interface{}{
+		"status": status,
+	})
+
+	resp, _, err := api.NewRequest("PUT", "/components/"+strconv.Itoa(id), jsonBytes)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("Could not update component status! Received %d", resp.StatusCode)
+	}
+
+	return nil
 }
 
 // TODO: test
 // NewRequest wraps http.NewRequest
 func (api CachetAPI) NewRequest(requestType, url string, reqBody []byte) (*http.Response, CachetResponse, error) {
+	if api.DryRun && requestType != "GET" {
+		return api.dryRunRequest(requestType, url, reqBody)
+	}
+
 	req, err := http.NewRequest(requestType, api.URL+url, bytes.NewBuffer(reqBody))
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("X-Cachet-Token", api.Token)
 
-	transport := http.DefaultTransport.(*http.Transport)
-	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: api.Insecure}
-	client := &http.Client{
-		Transport: transport,
+	client := api.client
+	if client == nil {
+		// not validated, the transport is only used for this request
+		client, err = api.httpClient("")
+		if err != nil {
+			return nil, CachetResponse{}, err
+		}
+
+		defer client.CloseIdleConnections()
 	}
 
 	res, err := client.Do(req)
 	if err != nil {
+		recordAPIRequest(requestType, 0, err)
 		return nil, CachetResponse{}, err
 	}
 
+	recordAPIRequest(requestType, res.StatusCode, nil)
+
+	defer res.Body.Close()
+
 	var body struct {
 		Data json.RawMessage `json:"data"`
 	}
 	err = json.NewDecoder(res.Body).Decode(&body)
 
-	defer req.Body.Close()
-
 	return res, body, err
 }
+
+// httpClient returns a new client, files are relative to dir. Certificates are verified unless insecure is set.
+func (api CachetAPI) httpClient(dir string) (*http.Client, error) {
+	tlsConfig, err := api.TLSConfig.Build(dir, api.Insecure)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy, err := api.Proxy.ProxyFunc(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Client{Transport: newTransport(tlsConfig, proxy)}, nil
+}
+
+// dryRunRequest logs the request and responds as if it succeeded
+func (api CachetAPI) dryRunRequest(requestType, url string, reqBody []byte) (*http.Response, CachetResponse, error) {
+	logrus.Infof("[dry run] %s %s%s %s", requestType, api.URL, url, string(reqBody))
+
+	res := &http.Response{
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+	}
+
+	if requestType != "POST" || url != "/incidents" {
+		return res, CachetResponse{Data: json.RawMessage(`{}`)}, nil
+	}
+
+	// only created incidents get an id
+	id := atomic.AddInt32(&dryRunIncidentID, 1)
+
+	return res, CachetResponse{Data: json.RawMessage(`{"id":` + strconv.Itoa(int(id)) + `}`)}, nil
+}
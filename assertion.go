@@ -0,0 +1,263 @@
+package cachet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/PaesslerAG/jsonpath"
+)
+
+// Assertion checks a value found with a JSONPath expression in a JSON response body,
+// eg. `$.status == "ok"`, `$.db.latency_ms < 200`, `$.items contains "db"` or `$.version exists`
+type Assertion struct {
+	expr string
+
+	path     string
+	operator string
+	expected interface{}
+
+	eval   func(context.Context, interface{}) (interface{}, error)
+	regexp *regexp.Regexp
+}
+
+// assertion operators, words are aliases of symbols
+var assertionOperators = map[string]string{
+	"==":       "==",
+	"equals":   "==",
+	"!=":       "!=",
+	">":        ">",
+	">=":       ">=",
+	"<":        "<",
+	"<=":       "<=",
+	"contains": "contains",
+	"exists":   "exists",
+	"=~":       "regex",
+	"regex":    "regex",
+}
+
+// ParseAssertion parses `<jsonpath> <operator> <value>`. Values are json (quoted strings, numbers, true, false,
+// null), anything else is used as a string.
+func ParseAssertion(expr string) (*Assertion, error) {
+	path, rest := splitJSONPath(strings.TrimSpace(expr))
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("Assertion %q: expected a JSONPath starting with $", expr)
+	}
+
+	a := &Assertion{expr: expr, path: path}
+
+	operator := rest
+	value := ""
+	if i := strings.IndexAny(rest, " \t"); i >= 0 {
+		operator, value = rest[:i], strings.TrimSpace(rest[i:])
+	}
+
+	if len(operator) == 0 {
+		operator = "exists"
+	}
+
+	var ok bool
+	if a.operator, ok = assertionOperators[operator]; !ok {
+		return nil, fmt.Errorf("Assertion %q: unknown operator %s", expr, operator)
+	}
+
+	if a.operator == "exists" {
+		if len(value) > 0 {
+			return nil, fmt.Errorf("Assertion %q: exists takes no value", expr)
+		}
+	} else if len(value) == 0 {
+		return nil, fmt.Errorf("Assertion %q: missing value", expr)
+	}
+
+	if err := json.Unmarshal([]byte(value), &a.expected); err != nil {
+		a.expected = value
+	}
+
+	switch a.operator {
+	case ">", ">=", "<", "<=":
+		if _, ok := a.expected.(float64); !ok {
+			return nil, fmt.Errorf("Assertion %q: %s needs a number", expr, a.operator)
+		}
+	case "regex":
+		exp, err := regexp.Compile(fmt.Sprint(a.expected))
+		if err != nil {
+			return nil, fmt.Errorf("Assertion %q: %v", expr, err)
+		}
+
+		a.regexp = exp
+	}
+
+	eval, err := jsonpath.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("Assertion %q: %v", expr, err)
+	}
+
+	a.eval = eval
+
+	return a, nil
+}
+
+// splitJSONPath splits the path off expr, at the first whitespace outside of brackets and quotes
+func splitJSONPath(expr string) (string, string) {
+	depth := 0
+	var quote rune
+	for i, c := range expr {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[' || c == '(':
+			depth++
+		case c == ']' || c == ')':
+			depth--
+		case depth == 0 && (c == ' ' || c == '\t'):
+			return expr[:i], strings.TrimSpace(expr[i:])
+		}
+	}
+
+	return expr, ""
+}
+
+func (a *Assertion) String() string {
+	return a.expr
+}
+
+// Check evaluates the assertion against a decoded json document. The error describes the failure, with the
+// actual value.
+func (a *Assertion) Check(document interface{}) error {
+	actual, err := a.eval(context.Background(), document)
+	if err != nil {
+		if a.operator == "exists" {
+			return fmt.Errorf("Assertion failed: %s (not found)", a.expr)
+		}
+
+		return fmt.Errorf("Assertion failed: %s (%v)", a.expr, err)
+	}
+
+	ok, err := a.compare(actual)
+	if err != nil {
+		return fmt.Errorf("Assertion failed: %s (%v, actual: %s)", a.expr, err, formatJSON(actual))
+	}
+
+	if !ok {
+		return fmt.Errorf("Assertion failed: %s (actual: %s)", a.expr, formatJSON(actual))
+	}
+
+	return nil
+}
+
+func (a *Assertion) compare(actual interface{}) (bool, error) {
+	switch a.operator {
+	case "exists":
+		return true, nil
+	case "==":
+		return jsonEqual(actual, a.expected), nil
+	case "!=":
+		return !jsonEqual(actual, a.expected), nil
+	case "contains":
+		switch value := actual.(type) {
+		case string:
+			return strings.Contains(value, fmt.Sprint(a.expected)), nil
+		case []interface{}:
+			for _, item := range value {
+				if jsonEqual(item, a.expected) {
+					return true, nil
+				}
+			}
+
+			return false, nil
+		}
+
+		return false, errors.New("not a string or a list")
+	case "regex":
+		if value, ok := actual.(string); ok {
+			return a.regexp.MatchString(value), nil
+		}
+
+		return a.regexp.MatchString(formatJSON(actual)), nil
+	}
+
+	value, ok := actual.(float64)
+	if !ok {
+		return false, errors.New("not a number")
+	}
+
+	expected := a.expected.(float64)
+	switch a.operator {
+	case ">":
+		return value > expected, nil
+	case ">=":
+		return value >= expected, nil
+	case "<":
+		return value < expected, nil
+	}
+
+	return value <= expected, nil
+}
+
+// jsonEqual compares decoded json values. Strings also equal numbers and booleans they format as.
+func jsonEqual(actual, expected interface{}) bool {
+	if reflect.DeepEqual(actual, expected) {
+		return true
+	}
+
+	if s, ok := expected.(string); ok {
+		return formatJSON(actual) == s
+	}
+
+	return false
+}
+
+func formatJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+
+	return string(data)
+}
+
+// parseAssertions parses assertion expressions, returning the problems found
+func parseAssertions(exprs []string) ([]*Assertion, []string) {
+	assertions := []*Assertion{}
+	errs := []string{}
+
+	for _, expr := range exprs {
+		assertion, err := ParseAssertion(expr)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		assertions = append(assertions, assertion)
+	}
+
+	return assertions, errs
+}
+
+// checkAssertions decodes the json body and checks each assertion, returning the first failure
+func checkAssertions(assertions []*Assertion, body []byte) error {
+	if len(assertions) == 0 {
+		return nil
+	}
+
+	var document interface{}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return fmt.Errorf("Response body is not json: %v", err)
+	}
+
+	for _, assertion := range assertions {
+		if err := assertion.Check(document); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
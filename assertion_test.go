@@ -0,0 +1,52 @@
+package cachet
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAssertions(t *testing.T) {
+	body := []byte(`{"status": "ok", "version": "1.2.3", "db": {"latency_ms": 120}, "features": ["db", "cache"], "items": [{"name": "a"}]}`)
+
+	tests := []struct {
+		expr   string
+		actual string
+	}{
+		{`$.status == "ok"`, ""},
+		{`$.status equals ok`, ""},
+		{`$.status != "down"`, ""},
+		{`$.db.latency_ms < 200`, ""},
+		{`$.db.latency_ms >= 120`, ""},
+		{`$.db.latency_ms > 200`, "actual: 120"},
+		{`$.features contains "cache"`, ""},
+		{`$.version =~ ^1\.`, ""},
+		{`$.version regex "^2\\."`, `actual: "1.2.3"`},
+		{`$.items[0].name == "a"`, ""},
+		{`$.db exists`, ""},
+		{`$.missing exists`, "not found"},
+		{`$.status > 1`, "not a number"},
+	}
+
+	for _, test := range tests {
+		assertion, err := ParseAssertion(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+
+		err = checkAssertions([]*Assertion{assertion}, body)
+		if len(test.actual) == 0 && err != nil {
+			t.Errorf("%s should pass: %v", test.expr, err)
+		}
+
+		if len(test.actual) > 0 && (err == nil || !strings.Contains(err.Error(), test.actual)) {
+			t.Errorf("%s should fail with %q, got %v", test.expr, test.actual, err)
+		}
+	}
+
+	for _, expr := range []string{`status == "ok"`, `$.a ~ 1`, `$.a < "x"`, `$.a ==`} {
+		if _, err := ParseAssertion(expr); err == nil {
+			t.Errorf("%s should not parse", expr)
+		}
+	}
+}
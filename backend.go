@@ -0,0 +1,190 @@
+package cachet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// StatusBackend publishes monitor state to a status page. CachetAPI is the default implementation.
+type StatusBackend interface {
+	Ping() error
+
+	// OpenIncident creates the incident and sets incident.ID
+	OpenIncident(incident *Incident) error
+	// UpdateIncident posts message with the incident's current status
+	UpdateIncident(incident *Incident, message string) error
+	// ResolveIncident marks the incident fixed and the component operational
+	ResolveIncident(incident *Incident, message string) error
+
+	GetComponent(id int) (Component, error)
+	SetComponentStatus(id int, status int) error
+	SendMetric(id int, value float64) error
+}
+
+// BackendConfig selects the StatusBackend
+type BackendConfig struct {
+	// cachet (default) / file / webhook
+	Type string `json:"type" yaml:"type"`
+
+	// file: path to append events to, stdout when empty or "-"
+	Path string `json:"path" yaml:"path"`
+
+	// webhook: url events are posted to
+	URL     string            `json:"url" yaml:"url"`
+	Headers map[string]string `json:"headers" yaml:"headers"`
+}
+
+// BackendEvent is written by the file backend and posted by the webhook backend
+type BackendEvent struct {
+	Time        time.Time `json:"time"`
+	Action      string    `json:"action"`
+	Incident    *Incident `json:"incident,omitempty"`
+	Message     string    `json:"message,omitempty"`
+	ComponentID int       `json:"component_id,omitempty"`
+	Status      int       `json:"status,omitempty"`
+	MetricID    int       `json:"metric_id,omitempty"`
+	Value       float64   `json:"value,omitempty"`
+}
+
+// newStatusBackend returns the backend selected in cfg.Backend
+func newStatusBackend(cfg *CachetMonitor) (StatusBackend, error) {
+	switch GetBackendType(cfg.Backend.Type) {
+	case "cachet":
+		if len(cfg.API.Token) == 0 || len(cfg.API.URL) == 0 {
+			return nil, errors.New("API URL or API Token missing.\nGet help at https://github.com/castawaylabs/cachet-monitor")
+		}
+
+		api := cfg.API
+		api.DryRun = cfg.DryRun
+
+		client, err := api.httpClient(cfg.dir)
+		if err != nil {
+			return nil, fmt.Errorf("api: %v", err)
+		}
+
+		api.client = client
+		return api, nil
+	case "file":
+		if cfg.DryRun {
+			return &eventBackend{write: dryRunWriter}, nil
+		}
+
+		return &eventBackend{write: fileWriter(cfg.Backend.Path)}, nil
+	case "webhook":
+		if len(cfg.Backend.URL) == 0 {
+			return nil, errors.New("Webhook backend requires an url")
+		}
+
+		if cfg.DryRun {
+			return &eventBackend{write: dryRunWriter}, nil
+		}
+
+		url, headers := cfg.Backend.URL, cfg.Backend.Headers
+		return &eventBackend{write: func(data []byte) error {
+			return postJSON(url, headers, data)
+		}}, nil
+	}
+
+	return nil, errors.New("Invalid backend type: " + cfg.Backend.Type)
+}
+
+func GetBackendType(t string) string {
+	if len(t) == 0 {
+		return "cachet"
+	}
+
+	return strings.ToLower(t)
+}
+
+// eventBackend is a StatusBackend which serialises every call as a BackendEvent
+type eventBackend struct {
+	write func([]byte) error
+
+	mu     sync.Mutex
+	lastID int
+}
+
+func (b *eventBackend) send(event BackendEvent) error {
+	event.Time = time.Now()
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.write(data)
+}
+
+func (b *eventBackend) Ping() error {
+	return b.send(BackendEvent{Action: "ping"})
+}
+
+func (b *eventBackend) OpenIncident(incident *Incident) error {
+	b.mu.Lock()
+	b.lastID++
+	incident.ID = b.lastID
+	b.mu.Unlock()
+
+	// partial outage
+	incident.ComponentStatus = 3
+
+	return b.send(BackendEvent{Action: "open_incident", Incident: incident})
+}
+
+func (b *eventBackend) UpdateIncident(incident *Incident, message string) error {
+	return b.send(BackendEvent{Action: "update_incident", Incident: incident, Message: message})
+}
+
+func (b *eventBackend) ResolveIncident(incident *Incident, message string) error {
+	incident.SetFixed()
+	incident.ComponentStatus = 1
+
+	return b.send(BackendEvent{Action: "resolve_incident", Incident: incident, Message: message})
+}
+
+func (b *eventBackend) GetComponent(id int) (Component, error) {
+	// components are not known outside of cachet
+	return Component{ID: id}, nil
+}
+
+func (b *eventBackend) SetComponentStatus(id int, status int) error {
+	return b.send(BackendEvent{Action: "set_component_status", ComponentID: id, Status: status})
+}
+
+func (b *eventBackend) SendMetric(id int, value float64) error {
+	return b.send(BackendEvent{Action: "send_metric", MetricID: id, Value: value})
+}
+
+// dryRunWriter logs events instead of writing them
+func dryRunWriter(data []byte) error {
+	logrus.Infof("[dry run] %s", string(data))
+	return nil
+}
+
+// fileWriter appends json lines to path, or stdout
+func fileWriter(path string) func([]byte) error {
+	return func(data []byte) error {
+		out := os.Stdout
+		if len(path) > 0 && path != "-" {
+			f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+			if err != nil {
+				return err
+			}
+
+			defer f.Close()
+			out = f
+		}
+
+		_, err := out.Write(append(data, '\n'))
+		return err
+	}
+}
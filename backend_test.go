@@ -0,0 +1,308 @@
+package cachet
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+)
+
+func TestNewStatusBackend(t *testing.T) {
+	tests := []struct {
+		backend BackendConfig
+		api     CachetAPI
+		valid   bool
+	}{
+		{BackendConfig{}, CachetAPI{URL: "https://demo.cachethq.io/api/v1", Token: "x"}, true},
+		{BackendConfig{Type: "Cachet"}, CachetAPI{URL: "https://demo.cachethq.io/api/v1"}, false},
+		{BackendConfig{Type: "file"}, CachetAPI{}, true},
+		{BackendConfig{Type: "webhook", URL: "https://example.com/events"}, CachetAPI{}, true},
+		{BackendConfig{Type: "webhook"}, CachetAPI{}, false},
+		{BackendConfig{Type: "statuspage"}, CachetAPI{}, false},
+	}
+
+	for _, test := range tests {
+		backend, err := newStatusBackend(&CachetMonitor{Backend: test.backend, API: test.api})
+		if (err == nil) != test.valid || (backend != nil) != test.valid {
+			t.Errorf("%+v: expected valid %v, got %v", test.backend, test.valid, err)
+		}
+	}
+}
+
+// fakeCachet serves the cachet api endpoints used by CachetAPI, recording requests
+type fakeCachet struct {
+	mu       sync.Mutex
+	requests []string
+}
+
+func (c *fakeCachet) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+
+	c.mu.Lock()
+	c.requests = append(c.requests, strings.TrimSpace(r.Method+" "+r.URL.Path+" "+string(body)))
+	c.mu.Unlock()
+
+	if r.Header.Get("X-Cachet-Token") != "token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/api/v1/components/1":
+		w.Write([]byte(`{"data": {"id": 1, "name": "web", "status": "3"}}`))
+	case r.Method == "POST" && r.URL.Path == "/api/v1/incidents":
+		w.Write([]byte(`{"data": {"id": 7}}`))
+	default:
+		w.Write([]byte(`{"data": {}}`))
+	}
+}
+
+func TestCachetAPIBackend(t *testing.T) {
+	cachet := &fakeCachet{}
+	server := httptest.NewServer(cachet)
+	defer server.Close()
+
+	backend, err := newStatusBackend(&CachetMonitor{API: CachetAPI{URL: server.URL + "/api/v1", Token: "token"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	incident := &Incident{Name: "web down", ComponentID: 1}
+	incident.SetInvestigating()
+	if err := backend.OpenIncident(incident); err != nil {
+		t.Fatal(err)
+	}
+
+	if incident.ID != 7 || incident.ComponentStatus != 4 {
+		t.Errorf("expected incident 7 with major outage, got %d with status %d", incident.ID, incident.ComponentStatus)
+	}
+
+	incident.SetWatching()
+	if err := backend.UpdateIncident(incident, "recovering"); err != nil {
+		t.Error(err)
+	}
+
+	if err := backend.ResolveIncident(incident, "fixed"); err != nil {
+		t.Error(err)
+	}
+
+	if err := backend.SendMetric(2, 150); err != nil {
+		t.Error(err)
+	}
+
+	if component, err := backend.GetComponent(1); err != nil || component.Name != "web" {
+		t.Errorf("expected component web, got %+v (%v)", component, err)
+	}
+
+	expected := []string{
+		"GET /api/v1/components/1",
+		"POST /api/v1/incidents",
+		`POST /api/v1/incidents/7/updates {"status":3,"message":"recovering"}`,
+		`POST /api/v1/incidents/7/updates {"status":4,"message":"fixed"}`,
+		`PUT /api/v1/components/1 {"status":1}`,
+		"POST /api/v1/metrics/2/points",
+		"GET /api/v1/components/1",
+	}
+
+	if len(cachet.requests) != len(expected) {
+		t.Fatalf("expected requests %v, got %v", expected, cachet.requests)
+	}
+
+	for i, request := range cachet.requests {
+		if !strings.HasPrefix(request, expected[i]) {
+			t.Errorf("request %d: expected %q, got %q", i, expected[i], request)
+		}
+	}
+
+	backend, _ = newStatusBackend(&CachetMonitor{API: CachetAPI{URL: server.URL + "/api/v1", Token: "wrong"}})
+	if err := backend.SetComponentStatus(1, 1); err == nil {
+		t.Error("expected rejected requests to fail")
+	}
+}
+
+// eventActions decodes json lines of backend events, returning their actions
+func eventActions(t *testing.T, data string) []string {
+	actions := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(data), "\n") {
+		var event BackendEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("invalid event %q: %v", line, err)
+		}
+
+		actions = append(actions, event.Action)
+	}
+
+	return actions
+}
+
+func sendBackendEvents(t *testing.T, backend StatusBackend) {
+	incident := &Incident{Name: "web down", ComponentID: 1}
+	if err := backend.OpenIncident(incident); err != nil || incident.ID != 1 {
+		t.Fatalf("expected incident 1, got %d (%v)", incident.ID, err)
+	}
+
+	backend.UpdateIncident(incident, "still down")
+	backend.ResolveIncident(incident, "fixed")
+	backend.SendMetric(2, 150)
+}
+
+func TestFileBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cachet-monitor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "events.jsonl")
+	backend, err := newStatusBackend(&CachetMonitor{Backend: BackendConfig{Type: "file", Path: path}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sendBackendEvents(t, backend)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"open_incident", "update_incident", "resolve_incident", "send_metric"}
+	if actions := eventActions(t, string(data)); !reflect.DeepEqual(actions, expected) {
+		t.Errorf("expected %v, got %v", expected, actions)
+	}
+}
+
+func TestWebhookBackend(t *testing.T) {
+	var mu sync.Mutex
+	events := new(strings.Builder)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+
+		mu.Lock()
+		events.Write(append(body, '\n'))
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	backend, err := newStatusBackend(&CachetMonitor{Backend: BackendConfig{
+		Type:    "webhook",
+		URL:     server.URL,
+		Headers: map[string]string{"X-Token": "secret"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sendBackendEvents(t, backend)
+
+	expected := []string{"open_incident", "update_incident", "resolve_incident", "send_metric"}
+	if actions := eventActions(t, events.String()); !reflect.DeepEqual(actions, expected) {
+		t.Errorf("expected %v, got %v", expected, actions)
+	}
+}
+
+// recordingNotifier records sent notifications
+type recordingNotifier struct {
+	AbstractNotifier
+	sent chan Notification
+}
+
+func (notifier *recordingNotifier) Send(n Notification) error {
+	notifier.sent <- n
+	return nil
+}
+
+func TestDryRun(t *testing.T) {
+	cachet := &fakeCachet{}
+	server := httptest.NewServer(cachet)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "cachet-monitor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	log := new(bytes.Buffer)
+	logrus.SetOutput(log)
+	defer logrus.SetOutput(os.Stderr)
+
+	configs := []*CachetMonitor{
+		{API: CachetAPI{URL: server.URL + "/api/v1", Token: "token"}},
+		{Backend: BackendConfig{Type: "file", Path: filepath.Join(dir, "events.jsonl")}},
+		{Backend: BackendConfig{Type: "webhook", URL: server.URL + "/events"}},
+	}
+
+	for _, cfg := range configs {
+		cfg.DryRun = true
+		backend, err := newStatusBackend(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		incident := &Incident{Name: "web down", ComponentID: 1}
+		if err := backend.OpenIncident(incident); err != nil || incident.ID == 0 {
+			t.Errorf("%s: expected dry run incident id, got %d (%v)", GetBackendType(cfg.Backend.Type), incident.ID, err)
+		}
+
+		backend.ResolveIncident(incident, "fixed")
+		backend.SendMetric(2, 150)
+	}
+
+	// updates, metrics and component changes do not use up incident ids
+	id := dryRunIncidentID
+	api := CachetAPI{URL: server.URL + "/api/v1", DryRun: true}
+	api.UpdateIncident(&Incident{ID: 1}, "watching")
+	api.SetComponentStatus(1, 1)
+	if dryRunIncidentID != id {
+		t.Errorf("expected ids for created incidents only, got %d after %d", dryRunIncidentID, id)
+	}
+
+	// reads are sent, writes are only logged
+	for _, request := range cachet.requests {
+		if !strings.HasPrefix(request, "GET ") {
+			t.Errorf("dry run sent %q", request)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "events.jsonl")); !os.IsNotExist(err) {
+		t.Errorf("dry run wrote the events file: %v", err)
+	}
+
+	for _, expected := range []string{"[dry run] POST " + server.URL + "/api/v1/incidents", "open_incident", "send_metric"} {
+		if !strings.Contains(log.String(), expected) {
+			t.Errorf("expected %q to be logged:\n%s", expected, log)
+		}
+	}
+
+	notifier := &recordingNotifier{sent: make(chan Notification, 1)}
+	notifier.Name = "ops"
+	cfg := &CachetMonitor{DryRun: true, Notifiers: []NotifierInterface{notifier}, DateFormat: DefaultTimeFormat}
+	mon := &AbstractMonitor{Name: "web", config: cfg}
+	mon.notify(EventOpen)
+
+	cfg.DryRun = false
+	mon.notify(EventResolve)
+
+	if n := <-notifier.sent; n.Event != EventResolve {
+		t.Errorf("expected only the resolve notification to be sent, got %v", n.Event)
+	}
+
+	if !strings.Contains(log.String(), "[dry run] notifier ops") {
+		t.Errorf("expected the dry run notification to be logged:\n%s", log)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Sirupsen/logrus"
+	cachet "github.com/castawaylabs/cachet-monitor"
+)
+
+// runCheck runs the selected monitors (all when names is empty) once and prints a result table.
+// Returns the process exit code.
+func runCheck(cfg *cachet.CachetMonitor, names []string) int {
+	// keep stdout for the result table
+	logrus.SetOutput(os.Stderr)
+
+	discovered := true
+	for _, err := range cfg.Discover() {
+		logrus.Warnf("Invalid configuration: %v", err)
+		discovered = discovered && err.Unknown
+	}
+
+	if valid := cfg.ValidateMonitors(); !valid || !discovered {
+		logrus.Errorf("Invalid configuration")
+		return 2
+	}
+
+	monitors := cfg.Monitors
+	if len(names) > 0 {
+		monitors = []cachet.MonitorInterface{}
+		for _, name := range names {
+			found := false
+			for _, monitor := range cfg.Monitors {
+				if monitor.GetMonitor().Name == name {
+					monitors = append(monitors, monitor)
+					found = true
+				}
+			}
+
+			if !found {
+				logrus.Errorf("Monitor not found: %s", name)
+				return 2
+			}
+		}
+	}
+
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "MONITOR\tTYPE\tRESULT\tLAG\tFAIL REASON")
+	for _, monitor := range monitors {
+		mon := monitor.GetMonitor()
+		result := cachet.Check(monitor)
+
+		status := "UP"
+		if !result.Up {
+			status = "DOWN"
+			failed++
+		}
+
+		reason := strings.Replace(result.FailReason, "\n", " ", -1)
+		ids := []int{}
+		for id := range result.Metrics {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+
+		for _, id := range ids {
+			reason = strings.TrimSpace(fmt.Sprintf("%s [metric %d: %v]", reason, id, result.Metrics[id]))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%dms\t%s\n", mon.Name, mon.Type, status, result.Lag, reason)
+	}
+	w.Flush()
+
+	if failed > 0 {
+		fmt.Printf("\n%d of %d checks failed\n", failed, len(monitors))
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	cachet "github.com/castawaylabs/cachet-monitor"
+)
+
+func TestRunCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/up" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	cfg, errs := cachet.ParseConfig([]byte(`{
+		"monitors": [
+			{"name": "up", "target": "`+server.URL+`/up", "component_id": 1, "expected_status_code": 200},
+			{"name": "down", "target": "`+server.URL+`/down", "component_id": 2, "expected_status_code": 200}
+		]
+	}`), "config.json")
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	tests := []struct {
+		names []string
+		code  int
+	}{
+		{[]string{"up"}, 0},
+		{[]string{"up", "down"}, 1},
+		{nil, 1},
+		{[]string{"missing"}, 2},
+	}
+
+	for _, test := range tests {
+		if code := runCheck(cfg, test.names); code != test.code {
+			t.Errorf("%v: expected exit code %d, got %d", test.names, test.code, code)
+		}
+	}
+
+	invalid, _ := cachet.ParseConfig([]byte(`{"monitors": [{"name": "invalid", "target": "https://example.com"}]}`), "config.json")
+	if code := runCheck(invalid, nil); code != 2 {
+		t.Errorf("invalid configuration: expected exit code 2, got %d", code)
+	}
+}
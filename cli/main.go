@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"net/http"
@@ -14,14 +13,15 @@ import (
 	"github.com/Sirupsen/logrus"
 	cachet "github.com/castawaylabs/cachet-monitor"
 	docopt "github.com/docopt/docopt-go"
-	"github.com/mitchellh/mapstructure"
-	"gopkg.in/yaml.v2"
 )
 
 const usage = `cachet-monitor
 
 Usage:
-  cachet-monitor (-c PATH | --config PATH) [--log=LOGPATH] [--name=NAME] [--immediate]
+  cachet-monitor (-c PATH | --config PATH) [--log=LOGPATH] [--name=NAME] [--immediate] [--dry-run]
+  cachet-monitor check (-c PATH | --config PATH) [--monitor=NAME...]
+  cachet-monitor validate (-c PATH | --config PATH)
+  cachet-monitor validate --schema
   cachet-monitor -h | --help | --version
 
 Arguments:
@@ -29,15 +29,24 @@ Arguments:
   LOGPATH  path to log output (defaults to STDOUT)
   NAME     name of this logger
 
+Commands:
+  check    run each monitor once, print the results and exit non-zero if any check failed (does not use cachet)
+  validate report all configuration errors and unknown keys, or print the configuration JSON Schema
+
 Examples:
   cachet-monitor -c /root/cachet-monitor.json
   cachet-monitor -c /root/cachet-monitor.json --log=/var/log/cachet-monitor.log --name="development machine"
+  cachet-monitor check -c /root/cachet-monitor.json --monitor=google
+  cachet-monitor validate --schema > cachet-monitor.schema.json
 
 Options:
   -c PATH.json --config PATH     Path to configuration file
   -h --help                      Show this screen.
   --version                      Show version
   --immediate                    Tick immediately (by default waits for first defined interval)
+  --dry-run                      Run checks, but log incidents, component status changes, metrics and notifications instead of sending them
+  --monitor=NAME                 Only check the named monitor (repeatable)
+  --schema                       Print the configuration JSON Schema
   
 Environment varaibles:
   CACHET_API      override API url from configuration
@@ -49,26 +58,34 @@ var version string
 func main() {
 	arguments, _ := docopt.Parse(usage, nil, true, version, false)
 
-	cfg, err := getConfiguration(arguments["--config"].(string))
-	if err != nil {
-		logrus.Panicf("Unable to start (reading config): %v", err)
+	if validate, ok := arguments["validate"].(bool); ok && validate {
+		if schema, ok := arguments["--schema"].(bool); ok && schema {
+			os.Exit(printSchema())
+		}
+
+		os.Exit(runValidate(arguments["--config"].(string)))
+	}
+
+	cfg := loadConfiguration(arguments["--config"].(string))
+
+	if check, ok := arguments["check"].(bool); ok && check {
+		os.Exit(runCheck(cfg, arguments["--monitor"].([]string)))
 	}
 
 	if immediate, ok := arguments["--immediate"]; ok {
 		cfg.Immediate = immediate.(bool)
 	}
 
+	if dryRun, ok := arguments["--dry-run"].(bool); ok {
+		cfg.DryRun = dryRun
+	}
+
 	if name := arguments["--name"]; name != nil {
 		cfg.SystemName = name.(string)
 	}
 	logrus.SetOutput(getLogger(arguments["--log"]))
 
-	if len(os.Getenv("CACHET_API")) > 0 {
-		cfg.API.URL = os.Getenv("CACHET_API")
-	}
-	if len(os.Getenv("CACHET_TOKEN")) > 0 {
-		cfg.API.Token = os.Getenv("CACHET_TOKEN")
-	}
+	applyEnvironment(cfg)
 	if len(os.Getenv("CACHET_DEV")) > 0 {
 		logrus.SetLevel(logrus.DebugLevel)
 	}
@@ -79,17 +96,32 @@ func main() {
 	}
 
 	logrus.Debug("Configuration valid")
+	if cfg.DryRun {
+		logrus.Warnf("Dry run: nothing will be sent to the backend or notifiers")
+	}
 	logrus.Infof("System: %s", cfg.SystemName)
-	logrus.Infof("API: %s", cfg.API.URL)
+	logrus.Infof("Backend: %s", cachet.GetBackendType(cfg.Backend.Type))
+	if cachet.GetBackendType(cfg.Backend.Type) == "cachet" {
+		logrus.Infof("API: %s", cfg.API.URL)
+	}
 	logrus.Infof("Monitors: %d\n", len(cfg.Monitors))
 
-	logrus.Infof("Pinging cachet")
-	if err := cfg.API.Ping(); err != nil {
-		logrus.Errorf("Cannot ping cachet!\n%v", err)
+	logrus.Infof("Pinging backend")
+	if err := cfg.StatusBackend.Ping(); err != nil {
+		logrus.Errorf("Cannot ping backend!\n%v", err)
 		os.Exit(1)
 	}
 	logrus.Infof("Ping OK")
 
+	if len(cfg.Server.Listen) > 0 {
+		logrus.Infof("Listening on %s", cfg.Server.Listen)
+		go func() {
+			if err := cfg.Serve(); err != nil {
+				logrus.Errorf("Server stopped: %v", err)
+			}
+		}()
+	}
+
 	wg := &sync.WaitGroup{}
 	for index, monitor := range cfg.Monitors {
 		logrus.Infof("Starting Monitor #%d: ", index)
@@ -98,12 +130,20 @@ func main() {
 		go monitor.ClockStart(cfg, monitor, wg)
 	}
 
+	for _, discovery := range cfg.Discoveries {
+		go discovery.Watch(cfg, wg)
+	}
+
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, os.Interrupt, os.Kill)
 	<-signals
 
 	logrus.Warnf("Abort: Waiting monitors to finish")
-	for _, mon := range cfg.Monitors {
+	for _, discovery := range cfg.Discoveries {
+		discovery.Stop()
+	}
+
+	for _, mon := range cfg.GetMonitors() {
 		mon.GetMonitor().ClockStop()
 	}
 
@@ -124,8 +164,8 @@ func getLogger(logPath interface{}) *os.File {
 	return file
 }
 
-func getConfiguration(path string) (*cachet.CachetMonitor, error) {
-	var cfg cachet.CachetMonitor
+// getConfiguration reads and parses configuration from a file or url
+func getConfiguration(path string) (*cachet.CachetMonitor, []cachet.ConfigError, error) {
 	var data []byte
 
 	// test if its a url
@@ -135,7 +175,7 @@ func getConfiguration(path string) (*cachet.CachetMonitor, error) {
 		response, err := http.Get(path)
 		if err != nil {
 			logrus.Warn("Unable to download network configuration")
-			return nil, err
+			return nil, nil, err
 		}
 
 		defer response.Body.Close()
@@ -145,54 +185,49 @@ func getConfiguration(path string) (*cachet.CachetMonitor, error) {
 	} else {
 		data, err = ioutil.ReadFile(path)
 		if err != nil {
-			return nil, errors.New("Unable to open file: '" + path + "'")
+			return nil, nil, errors.New("Unable to open file: '" + path + "'")
 		}
 	}
 
-	if strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml") {
-		err = yaml.Unmarshal(data, &cfg)
-	} else {
-		err = json.Unmarshal(data, &cfg)
+	cfg, errs := cachet.ParseConfig(data, path)
+	if cfg == nil {
+		return nil, nil, errs[0]
 	}
 
+	return cfg, errs, nil
+}
+
+// loadConfiguration reads configuration, logging any problems. Exits if the configuration cannot be used.
+func loadConfiguration(path string) *cachet.CachetMonitor {
+	cfg, errs, err := getConfiguration(path)
 	if err != nil {
-		logrus.Warnf("Unable to parse configuration file")
+		logrus.Panicf("Unable to start (reading config): %v", err)
 	}
 
-	cfg.Monitors = make([]cachet.MonitorInterface, len(cfg.RawMonitors))
-	for index, rawMonitor := range cfg.RawMonitors {
-		var t cachet.MonitorInterface
-		var err error
-
-		// get default type
-		monType := cachet.GetMonitorType("")
-		if t, ok := rawMonitor["type"].(string); ok {
-			monType = cachet.GetMonitorType(t)
-		}
-
-		switch monType {
-		case "http":
-			var s cachet.HTTPMonitor
-			err = mapstructure.Decode(rawMonitor, &s)
-			t = &s
-		case "dns":
-			var s cachet.DNSMonitor
-			err = mapstructure.Decode(rawMonitor, &s)
-			t = &s
-		default:
-			logrus.Errorf("Invalid monitor type (index: %d) %v", index, monType)
+	valid := true
+	for _, err := range errs {
+		if err.Unknown {
+			logrus.Warnf("Ignoring configuration: %v", err)
 			continue
 		}
 
-		t.GetMonitor().Type = monType
-
-		if err != nil {
-			logrus.Errorf("Unable to unmarshal monitor to type (index: %d): %v", index, err)
-			continue
-		}
+		logrus.Errorf("Invalid configuration: %v", err)
+		valid = false
+	}
 
-		cfg.Monitors[index] = t
+	if !valid {
+		os.Exit(1)
 	}
 
-	return &cfg, err
+	return cfg
+}
+
+// applyEnvironment overrides configuration from environment variables
+func applyEnvironment(cfg *cachet.CachetMonitor) {
+	if len(os.Getenv("CACHET_API")) > 0 {
+		cfg.API.URL = os.Getenv("CACHET_API")
+	}
+	if len(os.Getenv("CACHET_TOKEN")) > 0 {
+		cfg.API.Token = os.Getenv("CACHET_TOKEN")
+	}
 }
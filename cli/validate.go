@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/Sirupsen/logrus"
+	cachet "github.com/castawaylabs/cachet-monitor"
+)
+
+// runValidate prints every problem found in the configuration. Returns the process exit code.
+func runValidate(path string) int {
+	logrus.SetOutput(os.Stderr)
+	// problems are printed below
+	logrus.SetLevel(logrus.ErrorLevel)
+
+	cfg, errs, err := getConfiguration(path)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	applyEnvironment(cfg)
+	errs = append(errs, cfg.ValidationErrors(true)...)
+
+	errors := 0
+	for _, err := range errs {
+		if err.Unknown {
+			fmt.Printf("warning: %v\n", err)
+		} else {
+			fmt.Printf("error: %v\n", err)
+			errors++
+		}
+	}
+
+	// unknown keys are ignored, they only fail validation along with errors
+	if errors > 0 {
+		fmt.Printf("\n%d problems found in %s\n", len(errs), path)
+		return 1
+	}
+
+	if len(errs) > 0 {
+		fmt.Println()
+	}
+
+	fmt.Printf("%s is valid (%d monitors, %d notifiers)\n", path, len(cfg.Monitors), len(cfg.Notifiers))
+	return 0
+}
+
+// printSchema prints the configuration JSON Schema
+func printSchema() int {
+	schema, err := json.MarshalIndent(cachet.JSONSchema(), "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Println(string(schema))
+	return 0
+}
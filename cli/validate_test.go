@@ -0,0 +1,38 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cachet-monitor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stdout := os.Stdout
+	os.Stdout, _ = os.Open(os.DevNull)
+	defer func() { os.Stdout = stdout }()
+
+	configs := map[string]struct {
+		data string
+		code int
+	}{
+		"valid.yml":   {"api: {url: https://demo.cachethq.io/api/v1, token: x}\nmonitors: [{name: web, target: https://example.com, component_id: 1, expected_status_code: 200}]", 0},
+		"unknown.yml": {"api: {url: https://demo.cachethq.io/api/v1, token: x}\nmonitors: [{name: web, target: https://example.com, component_id: 1, expected_status_code: 200, bogus: 1}]", 0},
+		"invalid.yml": {"api: {url: https://demo.cachethq.io/api/v1, token: x}\nmonitors: [{name: web, target: https://example.com, bogus: 1}]", 1},
+	}
+
+	for name, config := range configs {
+		path := filepath.Join(dir, name)
+		ioutil.WriteFile(path, []byte(config.data), 0600)
+
+		if code := runValidate(path); code != config.code {
+			t.Errorf("%s: expected exit code %d, got %d", name, config.code, code)
+		}
+	}
+}
@@ -1,9 +1,12 @@
 package cachet
 
 import (
+	"fmt"
 	"net"
 	"os"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -11,17 +14,113 @@ import (
 
 type CachetMonitor struct {
 	SystemName  string                   `json:"system_name" yaml:"system_name"`
+	Region      string                   `json:"region" yaml:"region"`
 	DateFormat  string                   `json:"date_format" yaml:"date_format"`
 	API         CachetAPI                `json:"api"`
+	Backend     BackendConfig            `json:"backend" yaml:"backend"`
+	Server      ServerConfig             `json:"server" yaml:"server"`
 	RawMonitors []map[string]interface{} `json:"monitors" yaml:"monitors"`
+	// Include monitors from other files (glob patterns or directories)
+	Include []string `json:"include" yaml:"include"`
 
-	Monitors  []MonitorInterface `json:"-" yaml:"-"`
-	Immediate bool               `json:"-" yaml:"-"`
+	// Defaults are merged into every monitor
+	Defaults map[string]interface{} `json:"defaults" yaml:"defaults"`
+	// Profiles are named sets of monitor fields, which monitors (and profiles) `extend`
+	Profiles map[string]map[string]interface{} `json:"profiles" yaml:"profiles"`
+
+	// Templates are shared message templates, referenced by monitors with `use`
+	Templates map[string]MessageTemplate `json:"templates" yaml:"templates"`
+	// TemplateFiles (glob patterns) hold {{ define }} blocks available to every template
+	TemplateFiles []string `json:"template_files" yaml:"template_files"`
+
+	RawNotifiers []map[string]interface{} `json:"notifiers" yaml:"notifiers"`
+
+	Monitors  []MonitorInterface  `json:"-" yaml:"-"`
+	Notifiers []NotifierInterface `json:"-" yaml:"-"`
+	Immediate bool                `json:"-" yaml:"-"`
+	// DryRun logs incidents, component status changes, metrics and notifications instead of sending them
+	DryRun bool `json:"-" yaml:"-"`
+
+	// Discoveries keep monitors of discovered targets in sync, see Watch
+	Discoveries []*Discovery `json:"-" yaml:"-"`
+
+	// StatusBackend receives incidents, component statuses and metrics.
+	// Created from Backend on Validate, unless already set.
+	StatusBackend StatusBackend `json:"-" yaml:"-"`
+
+	sharedTpl *template.Template
+	// directory of the configuration file
+	dir string
+	// guards Monitors, which changes as targets are discovered
+	monitorsMu sync.RWMutex
+}
+
+// ConfigError is a problem found in the configuration
+type ConfigError struct {
+	// Path locates the problem, eg. monitors[1] or monitors[1].expected_status_code
+	Path string
+	// Name of the monitor/notifier the problem was found in, if any
+	Name    string
+	Message string
+
+	// Unknown is set for unknown keys, which are ignored
+	Unknown bool
+}
+
+func (e ConfigError) Error() string {
+	if len(e.Name) > 0 {
+		return fmt.Sprintf("%s (%s): %s", e.Path, e.Name, e.Message)
+	}
+
+	return e.Path + ": " + e.Message
 }
 
 // Validate configuration
 func (cfg *CachetMonitor) Validate() bool {
-	valid := true
+	return logConfigErrors(cfg.ValidationErrors(true))
+}
+
+// ValidateMonitors validates monitors, notifiers and templates, but not the status backend and admin server
+func (cfg *CachetMonitor) ValidateMonitors() bool {
+	return logConfigErrors(cfg.ValidationErrors(false))
+}
+
+// ValidationErrors validates the configuration (and the status backend and admin server secrets, if
+// withBackend is set), returning every problem found
+func (cfg *CachetMonitor) ValidationErrors(withBackend bool) []ConfigError {
+	errs := []ConfigError{}
+
+	// the status backend and admin server are not used by checks
+	if withBackend {
+		secrets := []struct {
+			path  string
+			value *string
+		}{
+			{"api.token", &cfg.API.Token},
+			{"server.token", &cfg.Server.Token},
+		}
+		for _, secret := range secrets {
+			value, err := resolveSecret(cfg.dir, *secret.value)
+			if err != nil {
+				errs = append(errs, ConfigError{Path: secret.path, Message: err.Error()})
+			}
+
+			*secret.value = value
+		}
+
+		for _, err := range resolveSecrets(cfg.dir, cfg.Backend.Headers) {
+			errs = append(errs, ConfigError{Path: "backend.headers", Message: err})
+		}
+
+		if cfg.StatusBackend == nil {
+			backend, err := newStatusBackend(cfg)
+			if err != nil {
+				errs = append(errs, ConfigError{Path: "backend", Message: err.Error()})
+			}
+
+			cfg.StatusBackend = backend
+		}
+	}
 
 	if len(cfg.SystemName) == 0 {
 		// get hostname
@@ -32,24 +131,122 @@ func (cfg *CachetMonitor) Validate() bool {
 		cfg.DateFormat = DefaultTimeFormat
 	}
 
-	if len(cfg.API.Token) == 0 || len(cfg.API.URL) == 0 {
-		logrus.Warnf("API URL or API Token missing.\nGet help at https://github.com/castawaylabs/cachet-monitor")
-		valid = false
+	if len(cfg.Monitors) == 0 && len(cfg.Discoveries) == 0 {
+		errs = append(errs, ConfigError{Path: "monitors", Message: "No monitors defined! See help for example configuration"})
+	}
+
+	if len(cfg.TemplateFiles) > 0 {
+		tpl, err := compileTemplateFiles(cfg.dir, cfg.TemplateFiles)
+		if err != nil {
+			errs = append(errs, ConfigError{Path: "template_files", Message: "Could not compile template files: " + err.Error()})
+		}
+
+		cfg.sharedTpl = tpl
+	}
+
+	for name, tpl := range cfg.Templates {
+		if len(tpl.Use) > 0 {
+			errs = append(errs, ConfigError{Path: "templates." + name, Message: "Shared template cannot use another shared template"})
+		}
+
+		if err := tpl.Compile(cfg, "templates."+name); err != nil {
+			errs = append(errs, ConfigError{Path: "templates." + name, Message: "Could not compile shared template: " + err.Error()})
+		}
 	}
 
-	if len(cfg.Monitors) == 0 {
-		logrus.Warnf("No monitors defined!\nSee help for example configuration")
-		valid = false
+	for index, notifier := range cfg.Notifiers {
+		n := notifier.GetNotifier()
+		n.config = cfg
+
+		path := n.configPath
+		if len(path) == 0 {
+			path = fmt.Sprintf("notifiers[%d]", index)
+		}
+
+		for _, err := range notifier.Validate() {
+			errs = append(errs, ConfigError{Path: path, Name: n.Name, Message: err})
+		}
 	}
 
 	for index, monitor := range cfg.Monitors {
-		if errs := monitor.Validate(); len(errs) > 0 {
-			logrus.Warnf("Monitor validation errors (index %d): %v", index, "\n - "+strings.Join(errs, "\n - "))
-			valid = false
+		path := monitor.GetMonitor().configPath
+		if len(path) == 0 {
+			path = fmt.Sprintf("monitors[%d]", index)
+		}
+
+		errs = append(errs, cfg.validateMonitor(path, monitor)...)
+	}
+
+	for _, d := range cfg.Discoveries {
+		for _, err := range cfg.validateMonitor(d.path, d.sample) {
+			// named after the definition rather than the sample
+			err.Name = d.name
+			errs = append(errs, err)
 		}
 	}
 
-	return valid
+	return errs
+}
+
+func (cfg *CachetMonitor) validateMonitor(path string, monitor MonitorInterface) []ConfigError {
+	errs := []ConfigError{}
+
+	mon := monitor.GetMonitor()
+	mon.config = cfg
+
+	for _, err := range monitor.Validate() {
+		errs = append(errs, ConfigError{Path: path, Name: mon.Name, Message: err})
+	}
+
+	return errs
+}
+
+// configDir returns the directory relative file references are resolved against, the working directory
+// when cfg was not loaded from a file
+func (cfg *CachetMonitor) configDir() string {
+	if cfg == nil {
+		return ""
+	}
+
+	return cfg.dir
+}
+
+// GetMonitors returns the running monitors, including discovered ones
+func (cfg *CachetMonitor) GetMonitors() []MonitorInterface {
+	cfg.monitorsMu.RLock()
+	defer cfg.monitorsMu.RUnlock()
+
+	return append([]MonitorInterface{}, cfg.Monitors...)
+}
+
+func (cfg *CachetMonitor) addMonitor(monitor MonitorInterface) {
+	cfg.monitorsMu.Lock()
+	defer cfg.monitorsMu.Unlock()
+
+	cfg.Monitors = append(cfg.Monitors, monitor)
+}
+
+func (cfg *CachetMonitor) removeMonitor(monitor MonitorInterface) {
+	cfg.monitorsMu.Lock()
+	defer cfg.monitorsMu.Unlock()
+
+	monitors := []MonitorInterface{}
+	for _, m := range cfg.Monitors {
+		if m != monitor {
+			monitors = append(monitors, m)
+		}
+	}
+
+	cfg.Monitors = monitors
+}
+
+// logConfigErrors logs errs, returns true if there are none
+func logConfigErrors(errs []ConfigError) bool {
+	for _, err := range errs {
+		logrus.Warnf("Invalid configuration: %v", err)
+	}
+
+	return len(errs) == 0
 }
 
 // getHostname returns id of the current system
@@ -80,10 +277,59 @@ func GetMonitorType(t string) string {
 }
 
 func getTemplateData(monitor *AbstractMonitor) map[string]interface{} {
+	return newTemplateData(monitor, monitor.getComponentName())
+}
+
+// getSampleTemplateData returns template data with placeholder values, used to validate templates on startup
+func getSampleTemplateData(monitor *AbstractMonitor) map[string]interface{} {
+	data := newTemplateData(monitor, "Sample component")
+
+	data["FailReason"] = "Sample fail reason"
+	data["FailReasons"] = []string{"Sample fail reason"}
+	data["FailureCount"] = 1
+	data["Lag"] = LagStats{Last: 100, Min: 10, Max: 100, Avg: 50}
+	data["IncidentStarted"] = time.Now().Add(-5 * time.Minute)
+	data["Duration"] = 5 * time.Minute
+	data["incident"] = &Incident{
+		ID:          1,
+		Name:        "Sample incident",
+		Message:     "Sample incident message",
+		Status:      1,
+		ComponentID: monitor.ComponentID,
+	}
+
+	return data
+}
+
+func newTemplateData(monitor *AbstractMonitor, componentName string) map[string]interface{} {
+	failures := 0
+	for _, up := range monitor.history {
+		if !up {
+			failures++
+		}
+	}
+
+	var started time.Time
+	var duration time.Duration
+	if monitor.incident != nil && !monitor.incident.startedAt.IsZero() {
+		started = monitor.incident.startedAt
+		duration = time.Since(started)
+	}
+
 	return map[string]interface{}{
-		"SystemName": monitor.config.SystemName,
-		"API":        monitor.config.API,
-		"Monitor":    monitor,
-		"now":        time.Now().Format(monitor.config.DateFormat),
+		"SystemName":      monitor.config.SystemName,
+		"Region":          monitor.config.Region,
+		"API":             monitor.config.API,
+		"Monitor":         monitor,
+		"Target":          monitor.Target,
+		"ComponentName":   componentName,
+		"FailReason":      monitor.lastFailReason,
+		"IncidentStarted": started,
+		"Duration":        duration,
+		"FailureCount":    failures,
+		"FailReasons":     monitor.failReasons,
+		"Lag":             monitor.getLagStats(),
+		"incident":        monitor.incident,
+		"now":             time.Now().Format(monitor.config.DateFormat),
 	}
 }
@@ -1,6 +1,10 @@
 package cachet
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -13,3 +17,293 @@ func TestGetMonitorType(t *testing.T) {
 		t.Error("does not return correct monitor type")
 	}
 }
+
+func TestParseConfigErrors(t *testing.T) {
+	cfg, errs := ParseConfig([]byte(`{
+		"api": {"url": "https://demo.cachethq.io/api/v1", "token": "x", "tokn": "y"},
+		"monitors": [
+			{"name": "google", "target": "https://google.com", "expected_status_code": "ok"},
+			{"name": "ftp", "type": "ftp"},
+			{"name": "dns", "type": "dns", "target": "google.com", "qestion": "A"}
+		]
+	}`), "config.json")
+
+	if cfg == nil {
+		t.Fatal("configuration should parse")
+	}
+
+	if len(cfg.Monitors) != 1 || cfg.Monitors[0].GetMonitor().Name != "dns" {
+		t.Errorf("only the dns monitor should decode, got %d monitors", len(cfg.Monitors))
+	}
+
+	expected := map[string]bool{
+		"api.tokn":                         true,
+		"monitors[0].expected_status_code": false,
+		"monitors[1].type":                 false,
+		"monitors[2].qestion":              true,
+	}
+
+	if len(errs) != len(expected) {
+		t.Errorf("expected %d errors, got %d: %v", len(expected), len(errs), errs)
+	}
+
+	for _, err := range errs {
+		unknown, ok := expected[err.Path]
+		if !ok {
+			t.Errorf("unexpected error: %v", err)
+		} else if unknown != err.Unknown {
+			t.Errorf("%v: expected unknown = %v", err, unknown)
+		}
+	}
+}
+
+func TestParseConfigInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cachet-monitor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Mkdir(filepath.Join(dir, "conf.d"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "conf.d", "web.yml"), []byte(`
+defaults:
+  interval: 30
+  expected_status_code: 200
+monitors:
+  - name: website
+    target: https://example.com
+  - name: google
+    target: https://google.com
+    interval: 60
+`), 0644)
+
+	cfg, errs := ParseConfig([]byte(`{
+		"include": ["conf.d"],
+		"monitors": [{"name": "google", "target": "https://google.com"}]
+	}`), filepath.Join(dir, "config.json"))
+
+	if len(cfg.Monitors) != 3 {
+		t.Fatalf("expected 3 monitors, got %d", len(cfg.Monitors))
+	}
+
+	website := cfg.Monitors[1].(*HTTPMonitor)
+	if website.Interval != 30 || website.ExpectedStatusCode != 200 {
+		t.Errorf("defaults not applied: %+v", website)
+	}
+
+	if google := cfg.Monitors[2].GetMonitor(); google.Interval != 60 {
+		t.Errorf("monitor should override defaults, got interval %d", google.Interval)
+	}
+
+	if len(errs) != 1 || !strings.Contains(errs[0].Message, "Duplicate monitor name") {
+		t.Errorf("expected duplicate name error, got %v", errs)
+	}
+}
+
+func TestParseConfigProfiles(t *testing.T) {
+	cfg, errs := ParseConfig([]byte(`
+defaults:
+  interval: 30
+  timeout: 5
+  expected_status_code: 200
+  intervall: 10
+profiles:
+  strict:
+    strict: true
+    threshold: 50
+  api:
+    extend: strict
+    expected_status_code: 204
+    headers:
+      Accept: application/json
+  loop:
+    extend: loop
+monitors:
+  - name: health
+    target: https://example.com/health
+    extend: api
+    timeout: 2
+    headers:
+      X-Token: secret
+  - name: broken
+    target: https://example.com
+    extend: [loop]
+  - name: dns
+    type: dns
+    target: example.com
+`), "config.yml")
+
+	if len(cfg.Monitors) != 2 {
+		t.Fatalf("expected 2 monitors, got %d", len(cfg.Monitors))
+	}
+
+	mon := cfg.Monitors[0].(*HTTPMonitor)
+	if mon.Interval != 30 || mon.Timeout != 2 || !mon.Strict || mon.Threshold != 50 || mon.ExpectedStatusCode != 204 {
+		t.Errorf("profiles not applied: %+v", mon)
+	}
+
+	if len(mon.Headers) != 2 {
+		t.Errorf("headers should be merged, got %v", mon.Headers)
+	}
+
+	// expected_status_code is not a dns field
+	if dns := cfg.Monitors[1].(*DNSMonitor); dns.Interval != 30 || dns.Timeout != 5 {
+		t.Errorf("defaults not applied to dns monitor: %+v", dns)
+	}
+
+	// reported once, not for every monitor
+	if len(errs) != 2 || errs[0].Path != "defaults.intervall" || !errs[0].Unknown {
+		t.Errorf("expected the unknown default to be reported, got %v", errs)
+	}
+
+	if len(errs) != 2 || errs[1].Path != "monitors[1].extend" {
+		t.Errorf("expected profile cycle error, got %v", errs)
+	}
+}
+
+func TestParseConfigTargets(t *testing.T) {
+	cfg, errs := ParseConfig([]byte(`
+monitors:
+  - name: "health {host}"
+    target: "https://{host}/health"
+    component_id: "{component}"
+    expected_status_code: 200
+    targets:
+      - host: web1.example.com
+        component: 3
+      - host: web2.example.com
+        component: 4
+  - name: "{region}-{env}"
+    target: "https://{env}.{region}.example.com"
+    component_id: 1
+    expected_status_code: 200
+    matrix:
+      region: [eu, us]
+      env: [prod, staging]
+  - name: "{site}"
+    component_id: 1
+    targets: [https://example.com]
+`), "config.yml")
+
+	if len(errs) != 1 || errs[0].Path != "monitors[2].targets[0].name" {
+		t.Errorf("expected unknown placeholder error, got %v", errs)
+	}
+
+	if len(cfg.Monitors) != 6 {
+		t.Fatalf("expected 6 monitors, got %d", len(cfg.Monitors))
+	}
+
+	web2 := cfg.Monitors[1].GetMonitor()
+	if web2.Name != "health web2.example.com" || web2.Target != "https://web2.example.com/health" || web2.ComponentID != 4 {
+		t.Errorf("target not expanded: %+v", web2)
+	}
+
+	if name := cfg.Monitors[5].GetMonitor().Name; name != "us-staging" {
+		t.Errorf("expected last matrix monitor us-staging, got %s", name)
+	}
+}
+
+func TestRelativeFilePaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cachet-monitor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Mkdir(filepath.Join(dir, "templates"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "token"), []byte("secret\n"), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "body.json"), []byte(`{"query": "ping"}`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "templates", "shared.tpl"), []byte(`{{ define "reason" }}{{ .FailReason }}{{ end }}`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "templates", "investigating.tpl"), []byte(`{{ template "reason" . }}`), 0644)
+
+	cfg, errs := ParseConfig([]byte(`
+api:
+  url: https://demo.cachethq.io/api/v1
+  token: file:token
+template_files: [templates/shared.tpl]
+monitors:
+  - name: api
+    target: https://example.com
+    component_id: 1
+    method: POST
+    body_file: body.json
+    headers:
+      X-Token: file:token
+    expected_status_code: 200
+    template:
+      investigating:
+        message_file: templates/investigating.tpl
+`), filepath.Join(dir, "config.yml"))
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	if errs := cfg.ValidationErrors(false); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	// the api token is only read with the status backend
+	if errs := cfg.ValidationErrors(true); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	monitor := cfg.Monitors[0].(*HTTPMonitor)
+	if cfg.API.Token != "secret" || monitor.Headers["X-Token"] != "secret" {
+		t.Errorf("secrets not read relative to the configuration: %q, %q", cfg.API.Token, monitor.Headers["X-Token"])
+	}
+
+	if string(monitor.body) != `{"query": "ping"}` {
+		t.Errorf("body_file not read relative to the configuration: %q", monitor.body)
+	}
+}
+
+func TestValidateMonitorsWithoutBackend(t *testing.T) {
+	cfg, errs := ParseConfig([]byte(`
+monitors:
+  - name: website
+    target: https://example.com
+    component_id: 1
+    expected_status_code: 200
+`), "config.yml")
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	if errs := cfg.ValidationErrors(false); len(errs) > 0 || cfg.StatusBackend != nil {
+		t.Errorf("monitors should validate without a status backend, got %v", errs)
+	}
+
+	if len(cfg.SystemName) == 0 || cfg.DateFormat != DefaultTimeFormat {
+		t.Errorf("defaults not set: %q, %q", cfg.SystemName, cfg.DateFormat)
+	}
+
+	if errs := cfg.ValidationErrors(true); len(errs) != 1 || errs[0].Path != "backend" {
+		t.Errorf("expected the missing API configuration to be reported, got %v", errs)
+	}
+}
+
+func TestValidateMonitorsSkipsSecrets(t *testing.T) {
+	cfg, errs := ParseConfig([]byte(`
+api:
+  url: https://demo.cachethq.io/api/v1
+  token: file:missing-token
+server:
+  token: file:missing-token
+monitors:
+  - name: website
+    target: https://example.com
+    component_id: 1
+    expected_status_code: 200
+`), "config.yml")
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	if errs := cfg.ValidationErrors(false); len(errs) > 0 {
+		t.Errorf("secrets should not be resolved without the status backend, got %v", errs)
+	}
+
+	if errs := cfg.ValidationErrors(true); len(errs) != 3 || errs[0].Path != "api.token" || errs[1].Path != "server.token" {
+		t.Errorf("expected the missing secrets to be reported, got %v", errs)
+	}
+}
@@ -0,0 +1,120 @@
+package cachet
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const dashboardHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{{ .Refresh }}">
+<title>{{ .SystemName }} - cachet-monitor</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #333; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: .5em; border-bottom: 1px solid #eee; vertical-align: middle; }
+.history span { display: inline-block; width: 8px; height: 16px; margin-right: 1px; }
+.up { background: #7ed321; }
+.down { background: #ff6f6f; }
+.paused { color: #999; }
+.incident { color: #ff6f6f; font-weight: bold; }
+.reason { font-family: monospace; font-size: .9em; max-width: 40em; white-space: pre-wrap; word-break: break-all; }
+polyline { fill: none; stroke: #3498db; stroke-width: 1.5; }
+</style>
+</head>
+<body>
+<h1>{{ .SystemName }}</h1>
+<p>{{ len .Monitors }} monitors, {{ .OpenIncidents }} open incidents. Updated {{ .Now }}.</p>
+<table>
+<tr><th>Monitor</th><th>History</th><th>Lag (ms)</th><th>Incident</th><th>Last error</th></tr>
+{{ range .Monitors }}
+<tr{{ if .Paused }} class="paused"{{ end }}>
+<td><strong>{{ .Name }}</strong> ({{ .Type }}){{ if .Paused }} - paused{{ end }}</td>
+<td class="history">{{ range .History }}<span class="{{ if . }}up{{ else }}down{{ end }}"></span>{{ end }}</td>
+<td>{{ if .LagHistory }}<svg width="120" height="24"><polyline points="{{ sparkline .LagHistory 120 24 }}"/></svg> {{ last .LagHistory }}{{ end }}</td>
+<td>{{ if .Incident }}<span class="incident">{{ if .IncidentID }}#{{ .IncidentID }}{{ else }}open{{ end }}</span>{{ else }}-{{ end }}</td>
+<td class="reason">{{ .LastFailReason }}</td>
+</tr>
+{{ end }}
+</table>
+</body>
+</html>`
+
+var dashboardTpl = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"sparkline": sparkline,
+	"last": func(values []int64) int64 {
+		return values[len(values)-1]
+	},
+}).Parse(dashboardHTML))
+
+// dashboardHandler renders monitor state as html
+func (cfg *CachetMonitor) dashboardHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	data := struct {
+		SystemName    string
+		Now           string
+		Refresh       int
+		OpenIncidents int
+		Monitors      []MonitorStatus
+	}{
+		SystemName: cfg.SystemName,
+		Now:        time.Now().Format(cfg.DateFormat),
+		Refresh:    10,
+	}
+
+	for _, monitor := range cfg.GetMonitors() {
+		status := GetStatus(monitor)
+		if status.Incident {
+			data.OpenIncidents++
+		}
+
+		data.Monitors = append(data.Monitors, status)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTpl.Execute(w, data); err != nil {
+		logrus.Warnf("Could not render dashboard: %v", err)
+	}
+}
+
+// sparkline returns svg polyline points plotting values in a width x height box
+func sparkline(values []int64, width, height int) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	max := values[0]
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	if max == 0 {
+		max = 1
+	}
+
+	step := 0.0
+	if len(values) > 1 {
+		step = float64(width) / float64(len(values)-1)
+	}
+
+	points := make([]string, len(values))
+	for i, v := range values {
+		x := step * float64(i)
+		y := float64(height) - float64(v)/float64(max)*float64(height-2) - 1
+		points[i] = fmt.Sprintf("%.1f,%.1f", x, y)
+	}
+
+	return strings.Join(points, " ")
+}
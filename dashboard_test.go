@@ -0,0 +1,88 @@
+package cachet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDashboard(t *testing.T) {
+	backend := &recordingBackend{}
+	web := newScriptedMonitor(backend, "down", "down", "down")
+	web.Name = "<b>web</b>"
+	for range web.results {
+		web.tick(web)
+	}
+
+	dns := newScriptedMonitor(backend, "")
+	dns.Name = "dns"
+	dns.tick(dns)
+
+	cfg := &CachetMonitor{
+		SystemName: "test",
+		DateFormat: DefaultTimeFormat,
+		Monitors:   []MonitorInterface{web, dns},
+	}
+
+	w := httptest.NewRecorder()
+	cfg.dashboardHandler(w, httptest.NewRequest("GET", "/", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	body := w.Body.String()
+	for _, expected := range []string{"2 monitors, 1 open incidents", "&lt;b&gt;web&lt;/b&gt;", "#1", "dns"} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected dashboard to contain %q:\n%s", expected, body)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	cfg.dashboardHandler(w, httptest.NewRequest("GET", "/favicon.ico", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for other paths, got %d", w.Code)
+	}
+}
+
+func TestDashboardIncidentNotCreated(t *testing.T) {
+	web := newScriptedMonitor(&recordingBackend{failOpen: 1}, "down", "down", "down")
+	web.Name = "web"
+	for range web.results {
+		web.tick(web)
+	}
+
+	cfg := &CachetMonitor{
+		DateFormat: DefaultTimeFormat,
+		Monitors:   []MonitorInterface{web},
+	}
+
+	w := httptest.NewRecorder()
+	cfg.dashboardHandler(w, httptest.NewRequest("GET", "/", nil))
+
+	body := w.Body.String()
+	for _, expected := range []string{"1 monitors, 1 open incidents", `<span class="incident">open</span>`} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected dashboard to contain %q:\n%s", expected, body)
+		}
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	tests := []struct {
+		values   []int64
+		expected string
+	}{
+		{nil, ""},
+		{[]int64{5}, "0.0,1.0"},
+		{[]int64{0, 0}, "0.0,19.0 100.0,19.0"},
+		{[]int64{0, 5, 10}, "0.0,19.0 50.0,10.0 100.0,1.0"},
+	}
+
+	for _, test := range tests {
+		if points := sparkline(test.values, 100, 20); points != test.expected {
+			t.Errorf("%v: expected %q, got %q", test.values, test.expected, points)
+		}
+	}
+}
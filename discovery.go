@@ -0,0 +1,373 @@
+package cachet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/miekg/dns"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// DefaultDiscoveryInterval is the default number of seconds between re-resolving discovered targets
+const DefaultDiscoveryInterval = 300
+
+// discoveryRetryInterval is the number of seconds before retrying a failed resolution, when shorter than the interval
+const discoveryRetryInterval = 10
+
+// DiscoveryConfig locates the targets of a monitor definition
+type DiscoveryConfig struct {
+	// SRV record name, eg. _http._tcp.example.com
+	SRV string `mapstructure:"srv"`
+	// DNS server (host:port) to query, defaults to the system resolver
+	DNS string `mapstructure:"dns"`
+	// File is a json/yaml inventory, a list of targets in the format of `targets`
+	File string `mapstructure:"file"`
+	// Interval (seconds) between re-resolving targets
+	Interval time.Duration `mapstructure:"interval"`
+}
+
+// Discovery expands a monitor definition across discovered targets, starting and stopping monitors as the
+// targets change
+type Discovery struct {
+	DiscoveryConfig
+
+	// path of the definition in the configuration
+	path string
+	name string
+	// definition, without discover
+	raw map[string]interface{}
+	// sample monitor expanded with placeholder values, validated with the configuration
+	sample MonitorInterface
+
+	// monitors by name
+	monitors map[string]MonitorInterface
+	mu       sync.Mutex
+	stopC    chan bool
+}
+
+// discoverMonitors decodes the discover settings of the definition at path. Targets are resolved once monitoring
+// starts (see Watch), or by Discover.
+func (cfg *CachetMonitor) discoverMonitors(path string, raw map[string]interface{}) ([]MonitorInterface, []ConfigError) {
+	name, _ := raw["name"].(string)
+
+	if _, ok := raw["targets"]; ok {
+		return nil, []ConfigError{{Path: path, Name: name, Message: "Cannot use both discover and targets"}}
+	}
+	if _, ok := raw["matrix"]; ok {
+		return nil, []ConfigError{{Path: path, Name: name, Message: "Cannot use both discover and matrix"}}
+	}
+
+	d := &Discovery{
+		path:     path,
+		name:     name,
+		raw:      map[string]interface{}{},
+		monitors: map[string]MonitorInterface{},
+		stopC:    make(chan bool),
+	}
+
+	for k, v := range raw {
+		if k != "discover" {
+			d.raw[k] = v
+		}
+	}
+
+	discover, ok := toStringMap(raw["discover"])
+	if !ok {
+		return nil, []ConfigError{{Path: path + ".discover", Name: name, Message: "Expected an object"}}
+	}
+
+	errs := decode(path+".discover", name, discover, &d.DiscoveryConfig)
+	if hasErrors(errs) {
+		return nil, errs
+	}
+
+	if (len(d.SRV) == 0) == (len(d.File) == 0) {
+		return nil, append(errs, ConfigError{Path: path + ".discover", Name: name, Message: "Set either srv or file"})
+	}
+
+	if len(d.File) > 0 {
+		d.File = joinPath(cfg.dir, d.File)
+	}
+
+	if len(d.DNS) == 0 {
+		d.DNS = defaultNameserver()
+	}
+
+	if d.Interval <= 0 {
+		d.Interval = DefaultDiscoveryInterval
+	}
+
+	// check the definition before any target is discovered, reporting problems under the definition
+	raw, field, err := expandMonitor(d.raw, sampleVariables(d.raw))
+	if err != nil {
+		return nil, append(errs, ConfigError{Path: path + "." + field, Name: name, Message: err.Error()})
+	}
+
+	sample, sampleErrs := decodeMonitor(path, raw)
+	for _, err := range sampleErrs {
+		err.Name = name
+		errs = append(errs, err)
+	}
+	if sample == nil {
+		return nil, errs
+	}
+
+	d.sample = sample
+	cfg.Discoveries = append(cfg.Discoveries, d)
+
+	return nil, errs
+}
+
+// sampleTargetVariables are used in place of discovered values to check a definition
+var sampleTargetVariables = map[string]string{
+	"host":     "example.com",
+	"port":     "80",
+	"priority": "1",
+	"weight":   "1",
+	"target":   "example.com:80",
+}
+
+// sampleVariables returns a value for every placeholder of the definition, "1" if the name is not an SRV
+// placeholder
+func sampleVariables(raw map[string]interface{}) map[string]string {
+	vars := map[string]string{"target": sampleTargetVariables["target"]}
+
+	for _, field := range expandedFields {
+		text, _ := raw[field].(string)
+		for _, match := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+			vars[match[1]] = "1"
+			if value, ok := sampleTargetVariables[match[1]]; ok {
+				vars[match[1]] = value
+			}
+		}
+	}
+
+	return vars
+}
+
+// Discover resolves the targets of every discovery once, adding their monitors to cfg.Monitors without
+// starting them. Used by one-shot checks, the daemon discovers targets as it starts watching.
+func (cfg *CachetMonitor) Discover() []ConfigError {
+	errs := []ConfigError{}
+
+	for _, d := range cfg.Discoveries {
+		d.mu.Lock()
+
+		targets, err := d.resolve()
+		if err != nil {
+			errs = append(errs, ConfigError{Path: d.path + ".discover", Name: d.name, Message: err.Error()})
+		}
+
+		for _, vars := range targets {
+			monitor, monitorErrs := d.decodeTarget(vars)
+			errs = append(errs, monitorErrs...)
+
+			if monitor == nil {
+				continue
+			}
+
+			name := monitor.GetMonitor().Name
+			if _, ok := d.monitors[name]; ok || cfg.findMonitor(name) != nil {
+				continue
+			}
+
+			d.monitors[name] = monitor
+			cfg.addMonitor(monitor)
+		}
+
+		d.mu.Unlock()
+	}
+
+	return errs
+}
+
+// decodeTarget decodes the monitor of a discovered target
+func (d *Discovery) decodeTarget(vars map[string]string) (MonitorInterface, []ConfigError) {
+	path := d.path + ".discover" + formatVariables(vars)
+
+	raw, field, err := expandMonitor(d.raw, vars)
+	if err != nil {
+		return nil, []ConfigError{{Path: path + "." + field, Name: d.name, Message: err.Error()}}
+	}
+
+	return decodeMonitor(path, raw)
+}
+
+// resolve returns the variables of the currently discovered targets
+func (d *Discovery) resolve() ([]map[string]string, error) {
+	if len(d.SRV) > 0 {
+		return resolveSRV(d.SRV, d.DNS)
+	}
+
+	return readInventory(d.File)
+}
+
+// resolveSRV looks up the SRV record name. Targets have {host}, {port}, {priority}, {weight} and
+// {target} (host:port) placeholders.
+func resolveSRV(name, server string) ([]map[string]string, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), dns.TypeSRV)
+	m.RecursionDesired = true
+
+	c := new(dns.Client)
+	r, _, err := c.Exchange(m, server)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Rcode != dns.RcodeSuccess {
+		return nil, errors.New("Unexpected DNS response code: " + dns.RcodeToString[r.Rcode])
+	}
+
+	targets := []map[string]string{}
+	for _, answer := range r.Answer {
+		srv, ok := answer.(*dns.SRV)
+		if !ok {
+			continue
+		}
+
+		host := strings.TrimSuffix(srv.Target, ".")
+		port := strconv.Itoa(int(srv.Port))
+		targets = append(targets, map[string]string{
+			"host":     host,
+			"port":     port,
+			"priority": strconv.Itoa(int(srv.Priority)),
+			"weight":   strconv.Itoa(int(srv.Weight)),
+			"target":   host + ":" + port,
+		})
+	}
+
+	sort.Slice(targets, func(i, j int) bool { return targets[i]["target"] < targets[j]["target"] })
+
+	return targets, nil
+}
+
+// readInventory reads a json or yaml list of targets
+func readInventory(file string) ([]map[string]string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []interface{}
+	if isYAML(file) {
+		err = yaml.Unmarshal(data, &targets)
+	} else {
+		err = json.Unmarshal(data, &targets)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse inventory %s: %v", file, err)
+	}
+
+	return targetVariables(targets)
+}
+
+// Watch resolves the targets, then re-resolves them every interval, starting monitors of new targets and
+// stopping monitors of removed targets, until Stop. Failed resolutions are retried sooner.
+func (d *Discovery) Watch(cfg *CachetMonitor, wg *sync.WaitGroup) {
+	for {
+		wait := d.Interval
+		if !d.refresh(cfg, wg) && wait > discoveryRetryInterval {
+			wait = discoveryRetryInterval
+		}
+
+		timer := time.NewTimer(wait * time.Second)
+		select {
+		case <-timer.C:
+		case <-d.stopC:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// Stop stops watching, waiting for a refresh in progress. No monitors are started once Stop returns.
+func (d *Discovery) Stop() {
+	close(d.stopC)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+}
+
+// refresh syncs the monitors with the current targets, returns false if they could not be resolved
+func (d *Discovery) refresh(cfg *CachetMonitor, wg *sync.WaitGroup) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	select {
+	case <-d.stopC:
+		return true
+	default:
+	}
+
+	l := logrus.WithFields(logrus.Fields{"discovery": d.path, "monitor": d.name})
+
+	targets, err := d.resolve()
+	if err != nil {
+		l.Warnf("Could not discover targets, keeping the current ones: %v", err)
+		return false
+	}
+
+	current := map[string]bool{}
+	for _, vars := range targets {
+		monitor, errs := d.decodeTarget(vars)
+		if monitor == nil {
+			l.Warnf("Ignoring discovered target %v: %v", vars, errs)
+			continue
+		}
+
+		name := monitor.GetMonitor().Name
+		current[name] = true
+		if _, ok := d.monitors[name]; ok {
+			continue
+		}
+
+		if cfg.findMonitor(name) != nil {
+			l.Warnf("Ignoring discovered target %v: duplicate monitor name %s", vars, name)
+			continue
+		}
+
+		if errs := cfg.validateMonitor(monitor.GetMonitor().configPath, monitor); len(errs) > 0 {
+			l.Warnf("Ignoring discovered target %v: %v", vars, errs)
+			continue
+		}
+
+		l.Infof("Discovered %s, starting monitor", name)
+		d.monitors[name] = monitor
+		cfg.addMonitor(monitor)
+
+		// added before Stop returns, so shutdown waits for the monitor
+		wg.Add(1)
+		go func(monitor MonitorInterface) {
+			defer wg.Done()
+			monitor.ClockStart(cfg, monitor, wg)
+		}(monitor)
+	}
+
+	for name, monitor := range d.monitors {
+		if current[name] {
+			continue
+		}
+
+		l.Infof("%s is no longer discovered, stopping monitor", name)
+		mon := monitor.GetMonitor()
+		mon.ClockStop()
+		// resolves the open incident, if any
+		mon.ResolveIncident()
+
+		delete(d.monitors, name)
+		cfg.removeMonitor(monitor)
+		forgetMonitor(mon)
+	}
+
+	return true
+}
@@ -0,0 +1,143 @@
+package cachet
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestDiscoveryInventory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cachet-monitor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	inventory := filepath.Join(dir, "hosts.yml")
+	ioutil.WriteFile(inventory, []byte("- web1.example.com\n- web2.example.com\n"), 0644)
+
+	cfg, errs := ParseConfig([]byte(`
+monitors:
+  - name: "health {target}"
+    target: "https://{target}/health"
+    component_id: 1
+    expected_status_code: 200
+    discover:
+      file: hosts.yml
+`), filepath.Join(dir, "config.yml"))
+
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	// targets are discovered as monitoring starts
+	if len(cfg.Monitors) != 0 || len(cfg.Discoveries) != 1 {
+		t.Fatalf("expected a discovery without monitors, got %d monitors", len(cfg.Monitors))
+	}
+
+	cfg.StatusBackend = &recordingBackend{}
+	cfg.DateFormat = DefaultTimeFormat
+
+	wg := &sync.WaitGroup{}
+	if !cfg.Discoveries[0].refresh(cfg, wg) || len(cfg.GetMonitors()) != 2 {
+		t.Fatalf("expected 2 discovered monitors, got %d", len(cfg.GetMonitors()))
+	}
+
+	ioutil.WriteFile(inventory, []byte("- web2.example.com\n- web3.example.com\n"), 0644)
+	cfg.Discoveries[0].refresh(cfg, wg)
+
+	os.Remove(inventory)
+	if cfg.Discoveries[0].refresh(cfg, wg) {
+		t.Error("expected a missing inventory to fail")
+	}
+
+	cfg.Discoveries[0].Stop()
+	if cfg.Discoveries[0].refresh(cfg, wg); len(cfg.GetMonitors()) != 2 {
+		t.Errorf("expected no monitors to be started after stop, got %d", len(cfg.GetMonitors()))
+	}
+
+	names := []string{}
+	for _, monitor := range cfg.GetMonitors() {
+		names = append(names, monitor.GetMonitor().Name)
+		monitor.GetMonitor().ClockStop()
+	}
+	sort.Strings(names)
+	wg.Wait()
+
+	if len(names) != 2 || names[0] != "health web2.example.com" || names[1] != "health web3.example.com" {
+		t.Errorf("expected web2 and web3 monitors, got %v", names)
+	}
+}
+
+func TestDiscoverySRVUnreachable(t *testing.T) {
+	cfg, errs := ParseConfig([]byte(`
+monitors:
+  - name: "health {host}"
+    target: "https://{target}/health"
+    component_id: 1
+    expected_status_code: 200
+    discover:
+      srv: _http._tcp.example.com
+      dns: 127.0.0.1:1
+`), "config.yml")
+
+	if len(errs) > 0 || len(cfg.Discoveries) != 1 {
+		t.Fatalf("expected the configuration to load without resolving, got %v", errs)
+	}
+
+	if errs := cfg.Discover(); len(errs) != 1 || errs[0].Path != "monitors[0].discover" {
+		t.Errorf("expected the resolution to fail, got %v", errs)
+	}
+}
+
+func TestDiscoveryDefinition(t *testing.T) {
+	cfg, errs := ParseConfig([]byte(`
+monitors:
+  - name: "health {host}"
+    target: "https://{host}:{port}/health"
+    component_id: 1
+    expected_status_code: 200
+    discover:
+      srv: _http._tcp.example.com
+`), "config.yml")
+
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	// discovered monitors only
+	if errs := cfg.ValidationErrors(false); len(errs) > 0 {
+		t.Errorf("expected the discovery to validate, got %v", errs)
+	}
+
+	cfg, errs = ParseConfig([]byte(`
+monitors:
+  - name: "health {host}"
+    target: "https://{host}/health"
+    component_id: 1
+    method: FROB
+    expected_status_codes: abc
+    bogus_key: 1
+    discover:
+      srv: _http._tcp.example.com
+`), "config.yml")
+
+	if len(errs) != 1 || errs[0].Path != "monitors[0].bogus_key" || !errs[0].Unknown {
+		t.Errorf("expected the unknown key to be reported, got %v", errs)
+	}
+
+	errs = cfg.ValidationErrors(false)
+	if len(errs) != 2 {
+		t.Errorf("expected the method and status codes to be invalid, got %v", errs)
+	}
+
+	for _, err := range errs {
+		if err.Path != "monitors[0]" {
+			t.Errorf("expected errors under the definition, got %v", err)
+		}
+	}
+
+}
@@ -1,6 +1,7 @@
 package cachet
 
 import (
+	"fmt"
 	"net"
 	"regexp"
 	"strings"
@@ -9,6 +10,46 @@ import (
 	"github.com/miekg/dns"
 )
 
+// Investigating template
+var defaultDNSInvestigatingTpl = MessageTemplate{
+	Subject: `{{ .Monitor.Name }} - {{ .SystemName }}`,
+	Message: `{{ .Monitor.Name }} DNS check **failed** (server time: {{ .now }})
+
+{{ .FailReason }}`,
+}
+
+// Identified template
+var defaultDNSIdentifiedTpl = MessageTemplate{
+	Subject: `{{ .Monitor.Name }} - {{ .SystemName }}`,
+	Message: `{{ .Monitor.Name }} DNS check is still **failing** (server time: {{ .now }})
+
+{{ .FailReason }}`,
+}
+
+// Watching template
+var defaultDNSWatchingTpl = MessageTemplate{
+	Subject: `{{ .Monitor.Name }} - {{ .SystemName }}`,
+	Message: `{{ .Monitor.Name }} DNS check is **recovering**, watching for further failures (server time: {{ .now }})`,
+}
+
+// Update template
+var defaultDNSUpdateTpl = MessageTemplate{
+	Subject: `{{ .Monitor.Name }} - {{ .SystemName }}`,
+	Message: `{{ .Monitor.Name }} DNS check **failed** (server time: {{ .now }})
+
+{{ .FailReason }}`,
+}
+
+// Fixed template
+var defaultDNSFixedTpl = MessageTemplate{
+	Subject: `{{ .Monitor.Name }} - {{ .SystemName }}`,
+	Message: `**Resolved** - {{ .now }}
+
+- - -
+
+{{ .incident.Message }}`,
+}
+
 type DNSAnswer struct {
 	Regex  string
 	regexp *regexp.Regexp
@@ -29,17 +70,16 @@ type DNSMonitor struct {
 }
 
 func (monitor *DNSMonitor) Validate() []string {
-	errs := monitor.AbstractMonitor.Validate()
+	monitor.Template.Investigating.SetDefault(defaultDNSInvestigatingTpl)
+	monitor.Template.Identified.SetDefault(defaultDNSIdentifiedTpl)
+	monitor.Template.Watching.SetDefault(defaultDNSWatchingTpl)
+	monitor.Template.Fixed.SetDefault(defaultDNSFixedTpl)
+	monitor.Template.Update.SetDefault(defaultDNSUpdateTpl)
 
-	if len(monitor.DNS) == 0 {
-		config, _ := dns.ClientConfigFromFile("/etc/resolv.conf")
-		if len(config.Servers) > 0 {
-			monitor.DNS = net.JoinHostPort(config.Servers[0], config.Port)
-		}
-	}
+	errs := monitor.AbstractMonitor.Validate()
 
 	if len(monitor.DNS) == 0 {
-		monitor.DNS = "8.8.8.8:53"
+		monitor.DNS = defaultNameserver()
 	}
 
 	if len(monitor.Question) == 0 {
@@ -70,10 +110,12 @@ func (monitor *DNSMonitor) test() bool {
 	r, _, err := c.Exchange(m, monitor.DNS)
 	if err != nil {
 		logrus.Warnf("DNS error: %v", err)
+		monitor.setFailReason(errorClass(err), err.Error())
 		return false
 	}
 
 	if r.Rcode != dns.RcodeSuccess {
+		monitor.setFailReason(FailDNS, "Unexpected DNS response code: "+dns.RcodeToString[r.Rcode])
 		return false
 	}
 
@@ -88,6 +130,7 @@ func (monitor *DNSMonitor) test() bool {
 
 		if !found {
 			logrus.Warnf("DNS check failed: %v. Not found in any of %v", check, r.Answer)
+			monitor.setFailReason(FailDNS, fmt.Sprintf("Expected answer %v not found in any of %v", check, r.Answer))
 			return false
 		}
 	}
@@ -95,6 +138,16 @@ func (monitor *DNSMonitor) test() bool {
 	return true
 }
 
+// defaultNameserver returns the first nameserver of /etc/resolv.conf, or google's
+func defaultNameserver() string {
+	config, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+	if err == nil && len(config.Servers) > 0 {
+		return net.JoinHostPort(config.Servers[0], config.Port)
+	}
+
+	return "8.8.8.8:53"
+}
+
 func findDNSType(t string) uint16 {
 	for rr, strType := range dns.TypeToString {
 		if t == strType {
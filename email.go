@@ -0,0 +1,81 @@
+package cachet
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EmailNotifier sends notifications over SMTP
+type EmailNotifier struct {
+	AbstractNotifier `mapstructure:",squash"`
+
+	Host     string
+	Port     int
+	Username string
+	Password string
+
+	From string
+	To   []string
+}
+
+func (notifier *EmailNotifier) Validate() []string {
+	errs := notifier.AbstractNotifier.Validate()
+
+	password, err := resolveSecret(notifier.config.configDir(), notifier.Password)
+	if err != nil {
+		errs = append(errs, "Password: "+err.Error())
+	}
+	notifier.Password = password
+
+	if len(notifier.Host) == 0 {
+		errs = append(errs, "SMTP host is required")
+	}
+
+	if notifier.Port == 0 {
+		notifier.Port = 25
+	}
+
+	if len(notifier.From) == 0 {
+		errs = append(errs, "From address is required")
+	}
+
+	if len(notifier.To) == 0 {
+		errs = append(errs, "At least one recipient (to) is required")
+	}
+
+	return errs
+}
+
+// headerLineBreaks are removed from header values, so rendered subjects cannot add headers
+var headerLineBreaks = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
+// bodyLineBreaks normalizes line breaks in the body to CRLF
+var bodyLineBreaks = strings.NewReplacer("\r\n", "\r\n", "\r", "\r\n", "\n", "\r\n")
+
+func (notifier *EmailNotifier) Send(n Notification) error {
+	var auth smtp.Auth
+	if len(notifier.Username) > 0 {
+		auth = smtp.PlainAuth("", notifier.Username, notifier.Password, notifier.Host)
+	}
+
+	addr := net.JoinHostPort(notifier.Host, strconv.Itoa(notifier.Port))
+	return smtp.SendMail(addr, auth, notifier.From, notifier.To, notifier.message(n))
+}
+
+// message returns the mail headers and body of n
+func (notifier *EmailNotifier) message(n Notification) []byte {
+	msg := new(bytes.Buffer)
+	fmt.Fprintf(msg, "From: %s\r\n", notifier.From)
+	fmt.Fprintf(msg, "To: %s\r\n", strings.Join(notifier.To, ", "))
+	fmt.Fprintf(msg, "Subject: %s\r\n", headerLineBreaks.Replace(n.Subject))
+	fmt.Fprintf(msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(bodyLineBreaks.Replace(n.Message))
+
+	return msg.Bytes()
+}
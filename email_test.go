@@ -0,0 +1,38 @@
+package cachet
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEmailMessage(t *testing.T) {
+	notifier := &EmailNotifier{From: "monitor@example.com", To: []string{"ops@example.com", "dev@example.com"}}
+
+	msg := string(notifier.message(Notification{
+		Subject: "web down\r\nBcc: attacker@example.com\rX-Injected: 1\nX-Injected: 2",
+		Message: "line 1\nline 2\r\nline 3\rline 4",
+	}))
+
+	headers := strings.SplitN(msg, "\r\n\r\n", 2)
+	if len(headers) != 2 {
+		t.Fatalf("expected headers and body, got %q", msg)
+	}
+
+	for _, line := range strings.Split(headers[0], "\r\n") {
+		if strings.ContainsAny(line, "\r\n") || strings.HasPrefix(line, "Bcc") || strings.HasPrefix(line, "X-Injected") {
+			t.Errorf("subject injected a header: %q", line)
+		}
+	}
+
+	if !strings.Contains(headers[0], "Subject: web down Bcc: attacker@example.com X-Injected: 1 X-Injected: 2\r\n") {
+		t.Errorf("unexpected subject in %q", headers[0])
+	}
+
+	if !strings.Contains(headers[0], "To: ops@example.com, dev@example.com") {
+		t.Errorf("unexpected recipients in %q", headers[0])
+	}
+
+	if headers[1] != "line 1\r\nline 2\r\nline 3\r\nline 4" {
+		t.Errorf("unexpected body %q", headers[1])
+	}
+}
@@ -0,0 +1,126 @@
+package cachet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PaesslerAG/jsonpath"
+)
+
+// Extractor finds a value in an HTTP response, with a JSONPath expression on the body, the first capture
+// group of a regular expression on the body (or the whole match), or a header
+type Extractor struct {
+	JSONPath string `mapstructure:"json_path"`
+	Regex    string
+	Header   string
+
+	eval   func(context.Context, interface{}) (interface{}, error)
+	regexp *regexp.Regexp
+}
+
+// Compile checks exactly one source is set and compiles it
+func (e *Extractor) Compile() error {
+	set := 0
+	for _, source := range []string{e.JSONPath, e.Regex, e.Header} {
+		if len(source) > 0 {
+			set++
+		}
+	}
+
+	if set != 1 {
+		return errors.New("Set one of json_path, regex or header")
+	}
+
+	if len(e.JSONPath) > 0 {
+		eval, err := jsonpath.New(e.JSONPath)
+		if err != nil {
+			return fmt.Errorf("Invalid json_path %s: %v", e.JSONPath, err)
+		}
+
+		e.eval = eval
+	}
+
+	if len(e.Regex) > 0 {
+		exp, err := regexp.Compile(e.Regex)
+		if err != nil {
+			return fmt.Errorf("Invalid regex %s: %v", e.Regex, err)
+		}
+
+		e.regexp = exp
+	}
+
+	return nil
+}
+
+// NeedsBody reports whether the value is extracted from the response body
+func (e *Extractor) NeedsBody() bool {
+	return len(e.Header) == 0
+}
+
+// Extract returns the value as a string
+func (e *Extractor) Extract(header http.Header, body []byte) (string, error) {
+	switch {
+	case len(e.Header) > 0:
+		value := header.Get(e.Header)
+		if len(value) == 0 {
+			return "", fmt.Errorf("Header %s not found", e.Header)
+		}
+
+		return value, nil
+	case e.regexp != nil:
+		match := e.regexp.FindSubmatch(body)
+		if match == nil {
+			return "", fmt.Errorf("Regex %s does not match", e.Regex)
+		}
+
+		if len(match) > 1 {
+			return string(match[1]), nil
+		}
+
+		return string(match[0]), nil
+	}
+
+	var document interface{}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return "", fmt.Errorf("Response body is not json: %v", err)
+	}
+
+	value, err := e.eval(context.Background(), document)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", e.JSONPath, err)
+	}
+
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+
+	return formatJSON(value), nil
+}
+
+// ExtractNumber returns the value as a number
+func (e *Extractor) ExtractNumber(header http.Header, body []byte) (float64, error) {
+	value, err := e.Extract(header, body)
+	if err != nil {
+		return 0, err
+	}
+
+	number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, fmt.Errorf("Not a number: %s", value)
+	}
+
+	return number, nil
+}
+
+// HTTPMetric posts a number extracted from the response to a cachet metric
+type HTTPMetric struct {
+	Extractor `mapstructure:",squash"`
+
+	MetricID int `mapstructure:"metric_id"`
+}
@@ -0,0 +1,44 @@
+package cachet
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestExtractor(t *testing.T) {
+	header := http.Header{}
+	header.Set("X-Queue-Depth", "42")
+	body := []byte(`{"users": {"active": 1234}, "version": "1.2"}`)
+
+	tests := []struct {
+		extractor Extractor
+		value     float64
+	}{
+		{Extractor{JSONPath: "$.users.active"}, 1234},
+		{Extractor{JSONPath: "$.version"}, 1.2},
+		{Extractor{Regex: `"active": (\d+)`}, 1234},
+		{Extractor{Header: "X-Queue-Depth"}, 42},
+	}
+
+	for _, test := range tests {
+		if err := test.extractor.Compile(); err != nil {
+			t.Fatal(err)
+		}
+
+		value, err := test.extractor.ExtractNumber(header, body)
+		if err != nil || value != test.value {
+			t.Errorf("%+v: expected %v, got %v (%v)", test.extractor, test.value, value, err)
+		}
+	}
+
+	missing := Extractor{JSONPath: "$.missing"}
+	missing.Compile()
+	if _, err := missing.ExtractNumber(header, body); err == nil {
+		t.Error("missing value should fail")
+	}
+
+	both := Extractor{JSONPath: "$.users", Header: "X-Queue-Depth"}
+	if err := both.Compile(); err == nil {
+		t.Error("extractor with two sources should not compile")
+	}
+}
@@ -1,13 +1,10 @@
 package cachet
 
 import (
-	"crypto/tls"
+	"fmt"
 	"io/ioutil"
-	"net/http"
-	"regexp"
-	"strconv"
-	"strings"
-	"time"
+
+	"github.com/Sirupsen/logrus"
 )
 
 // Investigating template
@@ -18,6 +15,28 @@ var defaultHTTPInvestigatingTpl = MessageTemplate{
 {{ .FailReason }}`,
 }
 
+// Identified template
+var defaultHTTPIdentifiedTpl = MessageTemplate{
+	Subject: `{{ .Monitor.Name }} - {{ .SystemName }}`,
+	Message: `{{ .Monitor.Name }} is still **failing** (server time: {{ .now }})
+
+{{ .FailReason }}`,
+}
+
+// Watching template
+var defaultHTTPWatchingTpl = MessageTemplate{
+	Subject: `{{ .Monitor.Name }} - {{ .SystemName }}`,
+	Message: `{{ .Monitor.Name }} is **recovering**, watching for further failures (server time: {{ .now }})`,
+}
+
+// Update template
+var defaultHTTPUpdateTpl = MessageTemplate{
+	Subject: `{{ .Monitor.Name }} - {{ .SystemName }}`,
+	Message: `{{ .Monitor.Name }} check **failed** (server time: {{ .now }})
+
+{{ .FailReason }}`,
+}
+
 // Fixed template
 var defaultHTTPFixedTpl = MessageTemplate{
 	Subject: `{{ .Monitor.Name }} - {{ .SystemName }}`,
@@ -29,89 +48,98 @@ var defaultHTTPFixedTpl = MessageTemplate{
 }
 
 type HTTPMonitor struct {
-	AbstractMonitor `mapstructure:",squash"`
+	AbstractMonitor  `mapstructure:",squash"`
+	HTTPRequest      `mapstructure:",squash"`
+	HTTPExpectations `mapstructure:",squash"`
+	HTTPClientConfig `mapstructure:",squash"`
 
-	Method             string
-	ExpectedStatusCode int `mapstructure:"expected_status_code"`
-	Headers            map[string]string
-
-	// compiled to Regexp
-	ExpectedBody string `mapstructure:"expected_body"`
-	bodyRegexp   *regexp.Regexp
+	// Metrics extracted from the response
+	Metrics []HTTPMetric
 }
 
 // TODO: test
 func (monitor *HTTPMonitor) test() bool {
-	req, err := http.NewRequest(monitor.Method, monitor.Target, nil)
-	for k, v := range monitor.Headers {
-		req.Header.Add(k, v)
-	}
-
-	transport := http.DefaultTransport.(*http.Transport)
-	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: monitor.Strict == false}
-	client := &http.Client{
-		Timeout:   time.Duration(monitor.Timeout * time.Second),
-		Transport: transport,
+	req, err := monitor.NewRequest(monitor.Target, nil)
+	if err != nil {
+		monitor.setFailReason(FailUnknown, err.Error())
+		return false
 	}
 
-	resp, err := client.Do(req)
+	resp, err := newHTTPClient(&monitor.AbstractMonitor, &monitor.HTTPClientConfig).Do(req)
 	if err != nil {
-		monitor.lastFailReason = err.Error()
+		monitor.setFailReason(errorClass(err), err.Error())
 		return false
 	}
 
 	defer resp.Body.Close()
 
-	if monitor.ExpectedStatusCode > 0 && resp.StatusCode != monitor.ExpectedStatusCode {
-		monitor.lastFailReason = "Expected HTTP response status: " + strconv.Itoa(monitor.ExpectedStatusCode) + ", got: " + strconv.Itoa(resp.StatusCode)
-		return false
-	}
-
-	if monitor.bodyRegexp != nil {
-		// check response body
-		responseBody, err := ioutil.ReadAll(resp.Body)
+	var responseBody []byte
+	if monitor.needsBody() {
+		responseBody, err = ioutil.ReadAll(resp.Body)
 		if err != nil {
-			monitor.lastFailReason = err.Error()
+			monitor.setFailReason(errorClass(err), err.Error())
 			return false
 		}
+	}
 
-		if !monitor.bodyRegexp.Match(responseBody) {
-			monitor.lastFailReason = "Unexpected body: " + string(responseBody) + ".\nExpected to match: " + monitor.ExpectedBody
-			return false
+	for i, metric := range monitor.Metrics {
+		value, err := metric.ExtractNumber(resp.Header, responseBody)
+		if err != nil {
+			logrus.Warnf("%s: could not extract metrics[%d]: %v", monitor.Name, i, err)
+			continue
 		}
+
+		monitor.setMetricValue(metric.MetricID, value)
+	}
+
+	if class, err := monitor.Check(resp, responseBody); err != nil {
+		monitor.setFailReason(class, err.Error())
+		return false
 	}
 
 	return true
 }
 
+// needsBody reports whether checks or metrics use the response body
+func (monitor *HTTPMonitor) needsBody() bool {
+	if monitor.HTTPExpectations.NeedsBody() {
+		return true
+	}
+
+	for _, metric := range monitor.Metrics {
+		if metric.NeedsBody() {
+			return true
+		}
+	}
+
+	return false
+}
+
 // TODO: test
 func (mon *HTTPMonitor) Validate() []string {
 	mon.Template.Investigating.SetDefault(defaultHTTPInvestigatingTpl)
+	mon.Template.Identified.SetDefault(defaultHTTPIdentifiedTpl)
+	mon.Template.Watching.SetDefault(defaultHTTPWatchingTpl)
 	mon.Template.Fixed.SetDefault(defaultHTTPFixedTpl)
+	mon.Template.Update.SetDefault(defaultHTTPUpdateTpl)
 
 	errs := mon.AbstractMonitor.Validate()
+	errs = append(errs, mon.HTTPRequest.Validate(mon.config.configDir())...)
+	errs = append(errs, mon.HTTPExpectations.Validate()...)
+	errs = append(errs, mon.HTTPClientConfig.Validate(mon.config.configDir(), mon.Strict)...)
 
-	if len(mon.ExpectedBody) > 0 {
-		exp, err := regexp.Compile(mon.ExpectedBody)
-		if err != nil {
-			errs = append(errs, "Regexp compilation failure: "+err.Error())
-		} else {
-			mon.bodyRegexp = exp
+	for i := range mon.Metrics {
+		if err := mon.Metrics[i].Compile(); err != nil {
+			errs = append(errs, fmt.Sprintf("metrics[%d]: %v", i, err))
 		}
-	}
 
-	if len(mon.ExpectedBody) == 0 && mon.ExpectedStatusCode == 0 {
-		errs = append(errs, "Both 'expected_body' and 'expected_status_code' fields empty")
+		if mon.Metrics[i].MetricID <= 0 {
+			errs = append(errs, fmt.Sprintf("metrics[%d]: metric_id is required", i))
+		}
 	}
 
-	mon.Method = strings.ToUpper(mon.Method)
-	switch mon.Method {
-	case "GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "HEAD":
-		break
-	case "":
-		mon.Method = "GET"
-	default:
-		errs = append(errs, "Unsupported HTTP method: "+mon.Method)
+	if mon.IsEmpty() {
+		errs = append(errs, "'expected_status_code(s)', 'expected_headers', 'expected_body' and 'assertions' fields all empty")
 	}
 
 	return errs
@@ -0,0 +1,378 @@
+package cachet
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTPExpectations check an HTTP response
+type HTTPExpectations struct {
+	ExpectedStatusCode int `mapstructure:"expected_status_code"`
+	// ExpectedStatusCodes is a list of codes and ranges, eg. "200-299, 301" or [200, "300-399"]
+	ExpectedStatusCodes interface{} `mapstructure:"expected_status_codes"`
+	statusCodes         []statusCodeRange
+
+	ExpectedHeaders []HeaderExpectation `mapstructure:"expected_headers"`
+
+	// ExpectedURL is a regexp the final URL (after redirects) must match
+	ExpectedURL string `mapstructure:"expected_url"`
+	urlRegexp   *regexp.Regexp
+	// ExpectedRedirects are regexps matching each URL redirected to, in order
+	ExpectedRedirects []string `mapstructure:"expected_redirects"`
+	redirectRegexps   []*regexp.Regexp
+
+	// compiled to Regexp
+	ExpectedBody string `mapstructure:"expected_body"`
+	bodyRegexp   *regexp.Regexp
+
+	// JSONPath assertions on the response body, eg. `$.status == "ok"`
+	Assertions []string
+	assertions []*Assertion
+}
+
+// HeaderExpectation checks a response header is present, equal to Exact or matching Regex
+type HeaderExpectation struct {
+	Name   string
+	Exact  string
+	Regex  string
+	regexp *regexp.Regexp
+}
+
+func (h HeaderExpectation) String() string {
+	switch {
+	case len(h.Regex) > 0:
+		return h.Name + " matching " + h.Regex
+	case len(h.Exact) > 0:
+		return h.Name + ": " + h.Exact
+	}
+
+	return h.Name
+}
+
+type statusCodeRange struct {
+	min, max int
+}
+
+// parseStatusCodes parses a list of codes and ranges, as a comma separated string or a list
+func parseStatusCodes(value interface{}) ([]statusCodeRange, error) {
+	var items []string
+	switch v := value.(type) {
+	case string:
+		items = strings.Split(v, ",")
+	case []interface{}:
+		for _, item := range v {
+			items = append(items, fmt.Sprint(item))
+		}
+	default:
+		items = []string{fmt.Sprint(v)}
+	}
+
+	ranges := []statusCodeRange{}
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		bounds := strings.SplitN(item, "-", 2)
+
+		min, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		max := min
+		if err == nil && len(bounds) == 2 {
+			max, err = strconv.Atoi(strings.TrimSpace(bounds[1]))
+		}
+
+		if err != nil || min < 100 || max > 599 || min > max {
+			return nil, fmt.Errorf("Invalid status code or range: %q", item)
+		}
+
+		ranges = append(ranges, statusCodeRange{min, max})
+	}
+
+	return ranges, nil
+}
+
+// Validate compiles the status codes, header and body regexps and assertions
+func (e *HTTPExpectations) Validate() []string {
+	errs := []string{}
+
+	if e.ExpectedStatusCodes != nil {
+		ranges, err := parseStatusCodes(e.ExpectedStatusCodes)
+		if err != nil {
+			errs = append(errs, "expected_status_codes: "+err.Error())
+		}
+
+		e.statusCodes = ranges
+
+		if e.ExpectedStatusCode > 0 {
+			errs = append(errs, "Set only one of expected_status_code and expected_status_codes")
+		}
+	}
+
+	if len(e.ExpectedURL) > 0 {
+		exp, err := regexp.Compile(e.ExpectedURL)
+		if err != nil {
+			errs = append(errs, "expected_url: "+err.Error())
+		}
+
+		e.urlRegexp = exp
+	}
+
+	e.redirectRegexps = nil
+	for i, redirect := range e.ExpectedRedirects {
+		exp, err := regexp.Compile(redirect)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("expected_redirects[%d]: %v", i, err))
+		}
+
+		e.redirectRegexps = append(e.redirectRegexps, exp)
+	}
+
+	for i, header := range e.ExpectedHeaders {
+		if len(header.Name) == 0 {
+			errs = append(errs, fmt.Sprintf("expected_headers[%d]: name is required", i))
+		}
+
+		if len(header.Regex) > 0 {
+			exp, err := regexp.Compile(header.Regex)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("expected_headers[%d]: %v", i, err))
+			}
+
+			e.ExpectedHeaders[i].regexp = exp
+		}
+	}
+
+	if len(e.ExpectedBody) > 0 {
+		exp, err := regexp.Compile(e.ExpectedBody)
+		if err != nil {
+			errs = append(errs, "Regexp compilation failure: "+err.Error())
+		} else {
+			e.bodyRegexp = exp
+		}
+	}
+
+	assertions, assertionErrs := parseAssertions(e.Assertions)
+	e.assertions = assertions
+
+	return append(errs, assertionErrs...)
+}
+
+// IsEmpty reports whether nothing is checked
+func (e *HTTPExpectations) IsEmpty() bool {
+	return len(e.ExpectedBody) == 0 && e.ExpectedStatusCode == 0 && e.ExpectedStatusCodes == nil &&
+		len(e.ExpectedHeaders) == 0 && len(e.ExpectedURL) == 0 && e.ExpectedRedirects == nil && len(e.Assertions) == 0
+}
+
+// NeedsBody reports whether the response body is checked
+func (e *HTTPExpectations) NeedsBody() bool {
+	return e.bodyRegexp != nil || len(e.assertions) > 0
+}
+
+// Check returns an error, and its fail class, if the response does not meet the expectations
+func (e *HTTPExpectations) Check(resp *http.Response, body []byte) (string, error) {
+	if e.ExpectedStatusCode > 0 && resp.StatusCode != e.ExpectedStatusCode {
+		return FailStatusCode, errors.New("Expected HTTP response status: " + strconv.Itoa(e.ExpectedStatusCode) + ", got: " + strconv.Itoa(resp.StatusCode))
+	}
+
+	if e.statusCodes != nil && !e.statusCodeExpected(resp.StatusCode) {
+		return FailStatusCode, fmt.Errorf("Expected HTTP response status: %v, got: %d", e.ExpectedStatusCodes, resp.StatusCode)
+	}
+
+	if e.urlRegexp != nil || e.ExpectedRedirects != nil {
+		chain := redirectChain(resp)
+		if class, err := e.checkRedirects(chain); err != nil {
+			return class, err
+		}
+	}
+
+	for _, header := range e.ExpectedHeaders {
+		values, ok := resp.Header[http.CanonicalHeaderKey(header.Name)]
+		if !ok {
+			return FailHeader, fmt.Errorf("Expected header %s, not found", header)
+		}
+
+		if !header.match(values) {
+			return FailHeader, fmt.Errorf("Expected header %s, got: %s", header, strings.Join(values, ", "))
+		}
+	}
+
+	// check response body
+	if e.bodyRegexp != nil && !e.bodyRegexp.Match(body) {
+		return FailBody, errors.New("Unexpected body: " + string(body) + ".\nExpected to match: " + e.ExpectedBody)
+	}
+
+	if err := checkAssertions(e.assertions, body); err != nil {
+		return FailBody, err
+	}
+
+	return "", nil
+}
+
+// checkRedirects checks the final URL and the URLs redirected to. chain starts with the requested URL.
+func (e *HTTPExpectations) checkRedirects(chain []string) (string, error) {
+	final := chain[len(chain)-1]
+	if e.urlRegexp != nil && !e.urlRegexp.MatchString(final) {
+		return FailRedirect, fmt.Errorf("Expected final URL matching %s, got: %s", e.ExpectedURL, strings.Join(chain, " -> "))
+	}
+
+	if e.ExpectedRedirects == nil {
+		return "", nil
+	}
+
+	redirects := chain[1:]
+	matches := len(redirects) == len(e.redirectRegexps)
+	for i := 0; matches && i < len(redirects); i++ {
+		matches = e.redirectRegexps[i].MatchString(redirects[i])
+	}
+
+	if !matches {
+		return FailRedirect, fmt.Errorf("Expected redirects to %s, got: %s", strings.Join(e.ExpectedRedirects, " -> "), strings.Join(chain, " -> "))
+	}
+
+	return "", nil
+}
+
+// redirectChain returns the URLs requested to get resp, starting with the first request
+func redirectChain(resp *http.Response) []string {
+	chain := []string{}
+	for req := resp.Request; req != nil; {
+		chain = append([]string{req.URL.String()}, chain...)
+
+		if req.Response == nil {
+			break
+		}
+		req = req.Response.Request
+	}
+
+	return chain
+}
+
+func (e *HTTPExpectations) statusCodeExpected(code int) bool {
+	for _, r := range e.statusCodes {
+		if code >= r.min && code <= r.max {
+			return true
+		}
+	}
+
+	return false
+}
+
+// match reports whether any of the header values matches
+func (h HeaderExpectation) match(values []string) bool {
+	for _, value := range values {
+		switch {
+		case h.regexp != nil:
+			if h.regexp.MatchString(value) {
+				return true
+			}
+		case len(h.Exact) > 0:
+			if value == h.Exact {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+
+	return false
+}
+
+// DefaultMaxRedirects is the number of redirects followed by default
+const DefaultMaxRedirects = 10
+
+// errTooManyRedirects is returned by checks which were redirected more than allowed
+var errTooManyRedirects = errors.New("Too many redirects")
+
+// HTTPClientConfig configures how HTTP checks connect
+type HTTPClientConfig struct {
+	// FollowRedirects is true (default, up to DefaultMaxRedirects), false, or the maximum number of redirects
+	FollowRedirects interface{} `mapstructure:"follow_redirects"`
+	maxRedirects    int
+
+	TLSConfig `mapstructure:",squash"`
+	Proxy     *ProxyConfig
+
+	// transport is built on validation and shared by the checks of the monitor
+	transport *http.Transport
+}
+
+// Validate parses follow_redirects and builds the transport from the TLS and proxy configuration, files are
+// relative to dir. Certificates are verified when strict is set or a ca_file is given.
+func (c *HTTPClientConfig) Validate(dir string, strict bool) []string {
+	tlsConfig, err := c.TLSConfig.Build(dir, !strict && len(c.CAFile) == 0)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	proxy, err := c.Proxy.ProxyFunc(dir)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	if c.transport != nil {
+		// validated again, eg. on reload
+		c.transport.CloseIdleConnections()
+	}
+
+	c.transport = newTransport(tlsConfig, proxy)
+
+	switch v := c.FollowRedirects.(type) {
+	case nil:
+		c.maxRedirects = DefaultMaxRedirects
+	case bool:
+		c.maxRedirects = 0
+		if v {
+			c.maxRedirects = DefaultMaxRedirects
+		}
+	case int:
+		c.maxRedirects = v
+	case float64:
+		c.maxRedirects = int(v)
+	default:
+		return []string{fmt.Sprintf("follow_redirects: expected true, false or a number, got %v", v)}
+	}
+
+	if c.maxRedirects < 0 {
+		return []string{"follow_redirects: cannot be negative"}
+	}
+
+	return nil
+}
+
+// newTransport returns a transport with the defaults of http.DefaultTransport
+func newTransport(tlsConfig *tls.Config, proxy func(*http.Request) (*url.URL, error)) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.Proxy = proxy
+
+	return transport
+}
+
+// newHTTPClient returns a client for the checks of mon, using the transport built on validation
+func newHTTPClient(mon *AbstractMonitor, c *HTTPClientConfig) *http.Client {
+	var transport http.RoundTripper = http.DefaultTransport
+	if c.transport != nil {
+		transport = c.transport
+	}
+
+	return &http.Client{
+		Timeout:   time.Duration(mon.Timeout * time.Second),
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if c.maxRedirects == 0 {
+				// not following, the redirect response is checked
+				return http.ErrUseLastResponse
+			}
+
+			if len(via) > c.maxRedirects {
+				return fmt.Errorf("%w: stopped after %d", errTooManyRedirects, c.maxRedirects)
+			}
+
+			return nil
+		},
+	}
+}
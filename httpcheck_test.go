@@ -0,0 +1,93 @@
+package cachet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPExpectations(t *testing.T) {
+	e := HTTPExpectations{
+		ExpectedStatusCodes: "200-299, 301",
+		ExpectedHeaders: []HeaderExpectation{
+			{Name: "content-type", Regex: "^application/json"},
+			{Name: "Cache-Control", Exact: "no-cache"},
+			{Name: "X-Cache"},
+		},
+	}
+	if errs := e.Validate(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json; charset=utf-8")
+	header.Add("Cache-Control", "private")
+	header.Add("Cache-Control", "no-cache")
+	header.Set("X-Cache", "HIT")
+
+	for code, class := range map[int]string{200: "", 204: "", 301: "", 302: FailStatusCode, 500: FailStatusCode} {
+		if got, _ := e.Check(&http.Response{StatusCode: code, Header: header}, nil); got != class {
+			t.Errorf("status %d: expected class %q, got %q", code, class, got)
+		}
+	}
+
+	header.Del("X-Cache")
+	if class, err := e.Check(&http.Response{StatusCode: 200, Header: header}, nil); class != FailHeader {
+		t.Errorf("missing header should fail, got %v", err)
+	}
+
+	for _, codes := range []interface{}{"200-", "299-200", "abc", []interface{}{200, "600"}} {
+		if _, err := parseStatusCodes(codes); err == nil {
+			t.Errorf("%v should not parse", codes)
+		}
+	}
+
+	if ranges, err := parseStatusCodes([]interface{}{200, "300-399"}); err != nil || len(ranges) != 2 {
+		t.Errorf("list should parse, got %v %v", ranges, err)
+	}
+}
+
+func TestHTTPRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+		case "/new":
+			http.Redirect(w, r, "/login", http.StatusFound)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		follow   interface{}
+		expected HTTPExpectations
+		class    string
+	}{
+		{nil, HTTPExpectations{ExpectedURL: "/login$", ExpectedRedirects: []string{"/new$", "/login$"}}, ""},
+		{nil, HTTPExpectations{ExpectedURL: "/dashboard$"}, FailRedirect},
+		{nil, HTTPExpectations{ExpectedRedirects: []string{"/new$"}}, FailRedirect},
+		{false, HTTPExpectations{ExpectedStatusCode: 301}, ""},
+		{1, HTTPExpectations{ExpectedStatusCode: 200}, FailRedirect},
+	}
+
+	for i, test := range tests {
+		monitor := &HTTPMonitor{}
+		monitor.Target = server.URL + "/old"
+		monitor.Name = "redirects"
+		monitor.Interval = 10
+		monitor.Timeout = 5
+		monitor.ComponentID = 1
+		monitor.FollowRedirects = test.follow
+		monitor.HTTPExpectations = test.expected
+		if errs := monitor.Validate(); len(errs) > 0 {
+			t.Fatal(errs)
+		}
+
+		up := monitor.test()
+		if up != (len(test.class) == 0) || monitor.lastFailClass != test.class {
+			t.Errorf("%d: expected class %q, got %v %q (%s)", i, test.class, up, monitor.lastFailClass, monitor.checkFailReason)
+		}
+	}
+}
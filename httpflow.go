@@ -0,0 +1,202 @@
+package cachet
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sort"
+)
+
+var defaultHTTPFlowInvestigatingTpl = MessageTemplate{
+	Subject: `{{ .Monitor.Name }} - {{ .SystemName }}`,
+	Message: `{{ .Monitor.Name }} flow check **failed** (server time: {{ .now }})
+
+{{ .FailReason }}`,
+}
+
+var defaultHTTPFlowIdentifiedTpl = MessageTemplate{
+	Subject: `{{ .Monitor.Name }} - {{ .SystemName }}`,
+	Message: `{{ .Monitor.Name }} flow check is still **failing** (server time: {{ .now }})
+
+{{ .FailReason }}`,
+}
+
+var defaultHTTPFlowWatchingTpl = MessageTemplate{
+	Subject: `{{ .Monitor.Name }} - {{ .SystemName }}`,
+	Message: `{{ .Monitor.Name }} flow check is **recovering**, watching for further failures (server time: {{ .now }})`,
+}
+
+var defaultHTTPFlowUpdateTpl = MessageTemplate{
+	Subject: `{{ .Monitor.Name }} - {{ .SystemName }}`,
+	Message: `{{ .Monitor.Name }} flow check **failed** (server time: {{ .now }})
+
+{{ .FailReason }}`,
+}
+
+var defaultHTTPFlowFixedTpl = MessageTemplate{
+	Subject: `{{ .Monitor.Name }} - {{ .SystemName }}`,
+	Message: `**Resolved** - {{ .now }}
+
+- - -
+
+{{ .incident.Message }}`,
+}
+
+// HTTPFlowStep is a request of a flow
+type HTTPFlowStep struct {
+	Name string
+	// URL of the request, relative to the monitor target. Defaults to the target.
+	URL string `mapstructure:"url"`
+
+	HTTPRequest      `mapstructure:",squash"`
+	HTTPExpectations `mapstructure:",squash"`
+
+	// Capture values from the response into variables, used as {name} in later steps
+	Capture map[string]*Extractor
+}
+
+// HTTPFlowMonitor runs steps in order, sharing cookies and captured variables.
+// The check fails at the first failing step.
+type HTTPFlowMonitor struct {
+	AbstractMonitor  `mapstructure:",squash"`
+	HTTPClientConfig `mapstructure:",squash"`
+
+	Steps []*HTTPFlowStep
+}
+
+func (monitor *HTTPFlowMonitor) test() bool {
+	jar, _ := cookiejar.New(nil)
+	client := newHTTPClient(&monitor.AbstractMonitor, &monitor.HTTPClientConfig)
+	client.Jar = jar
+
+	vars := map[string]string{}
+	for i, step := range monitor.Steps {
+		class, err := monitor.runStep(client, step, vars)
+		if err != nil {
+			monitor.setFailReason(class, fmt.Sprintf("Step %d/%d (%s): %v", i+1, len(monitor.Steps), step.Name, err))
+			return false
+		}
+	}
+
+	return true
+}
+
+// runStep sends the request of step and checks the response, capturing variables into vars
+func (monitor *HTTPFlowMonitor) runStep(client *http.Client, step *HTTPFlowStep, vars map[string]string) (string, error) {
+	target, err := resolveURL(monitor.Target, replaceVariables(step.URL, vars))
+	if err != nil {
+		return FailUnknown, err
+	}
+
+	req, err := step.NewRequest(target, vars)
+	if err != nil {
+		return FailUnknown, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return errorClass(err), err
+	}
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errorClass(err), err
+	}
+
+	if class, err := step.Check(resp, body); err != nil {
+		return class, err
+	}
+
+	names := []string{}
+	for name := range step.Capture {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value, err := step.Capture[name].Extract(resp.Header, body)
+		if err != nil {
+			return FailBody, fmt.Errorf("Cannot capture %s: %v", name, err)
+		}
+
+		vars[name] = value
+	}
+
+	return "", nil
+}
+
+// resolveURL resolves ref against base, an empty ref is base
+func resolveURL(base, ref string) (string, error) {
+	if len(ref) == 0 {
+		return base, nil
+	}
+
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+
+	return baseURL.ResolveReference(refURL).String(), nil
+}
+
+func (monitor *HTTPFlowMonitor) Validate() []string {
+	monitor.Template.Investigating.SetDefault(defaultHTTPFlowInvestigatingTpl)
+	monitor.Template.Identified.SetDefault(defaultHTTPFlowIdentifiedTpl)
+	monitor.Template.Watching.SetDefault(defaultHTTPFlowWatchingTpl)
+	monitor.Template.Fixed.SetDefault(defaultHTTPFlowFixedTpl)
+	monitor.Template.Update.SetDefault(defaultHTTPFlowUpdateTpl)
+
+	errs := monitor.AbstractMonitor.Validate()
+	errs = append(errs, monitor.HTTPClientConfig.Validate(monitor.config.configDir(), monitor.Strict)...)
+
+	if len(monitor.Steps) == 0 {
+		errs = append(errs, "No steps defined")
+	}
+
+	for i, step := range monitor.Steps {
+		if len(step.Name) == 0 {
+			step.Name = fmt.Sprintf("step %d", i+1)
+		}
+
+		prefix := fmt.Sprintf("steps[%d] (%s): ", i, step.Name)
+		for _, err := range append(step.HTTPRequest.Validate(monitor.config.configDir()), step.HTTPExpectations.Validate()...) {
+			errs = append(errs, prefix+err)
+		}
+
+		if step.IsEmpty() && len(step.Capture) == 0 {
+			errs = append(errs, prefix+"'expected_status_code(s)', 'expected_headers', 'expected_body', 'assertions' and 'capture' fields all empty")
+		}
+
+		for name, capture := range step.Capture {
+			if capture == nil {
+				errs = append(errs, prefix+"capture "+name+": Set one of json_path, regex or header")
+				continue
+			}
+
+			if err := capture.Compile(); err != nil {
+				errs = append(errs, prefix+"capture "+name+": "+err.Error())
+			}
+		}
+	}
+
+	return errs
+}
+
+func (monitor *HTTPFlowMonitor) Describe() []string {
+	features := monitor.AbstractMonitor.Describe()
+
+	for i, step := range monitor.Steps {
+		features = append(features, fmt.Sprintf("Step %d: %s %s %s", i+1, step.Name, step.Method, step.URL))
+	}
+
+	return features
+}
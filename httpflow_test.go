@@ -0,0 +1,67 @@
+package cachet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPFlowMonitor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1"})
+			w.Write([]byte(`{"token": "t1"}`))
+		case "/me":
+			cookie, _ := r.Cookie("session")
+			if r.Header.Get("Authorization") != "Bearer t1" || cookie == nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			w.Write([]byte(`{"user": "monitor"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cfg, errs := ParseConfig([]byte(`
+monitors:
+  - name: journey
+    type: http_flow
+    target: `+server.URL+`
+    component_id: 1
+    steps:
+      - name: login
+        url: /login
+        method: POST
+        form:
+          user: monitor
+        expected_status_code: 200
+        capture:
+          token:
+            json_path: $.token
+      - name: profile
+        url: /me
+        bearer_token: "{token}"
+        assertions:
+          - $.user == "monitor"
+      - name: logout
+        url: /logout
+        expected_status_code: 204
+`), "config.yml")
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	if errs := cfg.ValidationErrors(false); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	result := Check(cfg.Monitors[0])
+	if result.Up || !strings.HasPrefix(result.FailReason, "Step 3/3 (logout): Expected HTTP response status: 204, got: 404") {
+		t.Errorf("expected the logout step to fail, got %+v", result)
+	}
+}
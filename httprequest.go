@@ -0,0 +1,244 @@
+package cachet
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// BasicAuth credentials, the password can be a secret reference (file:...)
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+// HTTPRequest configures the request sent by HTTP checks
+type HTTPRequest struct {
+	Method  string
+	Headers map[string]string
+
+	// request body, one of
+	Body     string
+	BodyFile string `mapstructure:"body_file"`
+	// JSON is sent encoded as application/json
+	JSON interface{} `mapstructure:"json"`
+	// Form is sent encoded as application/x-www-form-urlencoded, values can be secret references
+	Form map[string]string
+
+	BasicAuth *BasicAuth `mapstructure:"basic_auth"`
+	// BearerToken is sent as Authorization header, can be a secret reference
+	BearerToken string `mapstructure:"bearer_token"`
+
+	body        []byte
+	json        interface{}
+	form        url.Values
+	contentType string
+}
+
+// Validate sets the default method, resolves secrets and encodes the body. Relative file references are
+// resolved against dir.
+func (r *HTTPRequest) Validate(dir string) []string {
+	errs := resolveSecrets(dir, r.Headers)
+
+	r.Method = strings.ToUpper(r.Method)
+	switch r.Method {
+	case "GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "HEAD":
+		break
+	case "":
+		r.Method = "GET"
+	default:
+		errs = append(errs, "Unsupported HTTP method: "+r.Method)
+	}
+
+	bodies := 0
+	for _, set := range []bool{len(r.Body) > 0, len(r.BodyFile) > 0, r.JSON != nil, len(r.Form) > 0} {
+		if set {
+			bodies++
+		}
+	}
+
+	if bodies > 1 {
+		errs = append(errs, "Set only one of body, body_file, json and form")
+	}
+
+	switch {
+	case len(r.Body) > 0:
+		r.body = []byte(r.Body)
+	case len(r.BodyFile) > 0:
+		body, err := ioutil.ReadFile(joinPath(dir, r.BodyFile))
+		if err != nil {
+			errs = append(errs, "Cannot read body_file: "+err.Error())
+		}
+
+		r.body = body
+	case r.JSON != nil:
+		r.json = jsonValue(r.JSON)
+		body, err := json.Marshal(r.json)
+		if err != nil {
+			errs = append(errs, "Cannot encode json: "+err.Error())
+		}
+
+		r.body = body
+		r.contentType = "application/json"
+	case len(r.Form) > 0:
+		values := url.Values{}
+		for k, v := range r.Form {
+			secret, err := resolveSecret(dir, v)
+			if err != nil {
+				errs = append(errs, "Form field "+k+": "+err.Error())
+			}
+
+			values.Set(k, secret)
+		}
+
+		r.form = values
+		r.body = []byte(values.Encode())
+		r.contentType = "application/x-www-form-urlencoded"
+	}
+
+	if r.BasicAuth != nil {
+		password, err := resolveSecret(dir, r.BasicAuth.Password)
+		if err != nil {
+			errs = append(errs, "basic_auth password: "+err.Error())
+		}
+
+		r.BasicAuth.Password = password
+	}
+
+	token, err := resolveSecret(dir, r.BearerToken)
+	if err != nil {
+		errs = append(errs, "bearer_token: "+err.Error())
+	}
+	r.BearerToken = token
+
+	if r.BasicAuth != nil && len(r.BearerToken) > 0 {
+		errs = append(errs, "Set only one of basic_auth and bearer_token")
+	}
+
+	return errs
+}
+
+// NewRequest creates the request to target. {name} placeholders in the target, headers, body, json strings,
+// form values and credentials are replaced with vars, unknown placeholders are left as is.
+func (r *HTTPRequest) NewRequest(target string, vars map[string]string) (*http.Request, error) {
+	body := r.body
+	if len(vars) > 0 {
+		target = replaceVariables(target, vars)
+
+		switch {
+		case r.json != nil:
+			// encoded after replacing, so values are escaped
+			encoded, err := json.Marshal(replaceJSONVariables(r.json, vars))
+			if err != nil {
+				return nil, err
+			}
+
+			body = encoded
+		case r.form != nil:
+			values := url.Values{}
+			for k := range r.form {
+				values.Set(k, replaceVariables(r.form.Get(k), vars))
+			}
+
+			body = []byte(values.Encode())
+		default:
+			body = []byte(replaceVariables(string(body), vars))
+		}
+	}
+
+	req, err := http.NewRequest(r.Method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(r.contentType) > 0 {
+		req.Header.Set("Content-Type", r.contentType)
+	}
+
+	if r.BasicAuth != nil {
+		req.SetBasicAuth(replaceVariables(r.BasicAuth.Username, vars), replaceVariables(r.BasicAuth.Password, vars))
+	}
+
+	if len(r.BearerToken) > 0 {
+		req.Header.Set("Authorization", "Bearer "+replaceVariables(r.BearerToken, vars))
+	}
+
+	// headers override the defaults above
+	for k, v := range r.Headers {
+		req.Header.Set(k, replaceVariables(v, vars))
+	}
+
+	return req, nil
+}
+
+// replaceVariables replaces {name} placeholders with vars, leaving unknown placeholders
+func replaceVariables(text string, vars map[string]string) string {
+	if len(vars) == 0 {
+		return text
+	}
+
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		if value, ok := vars[placeholder[1:len(placeholder)-1]]; ok {
+			return value
+		}
+
+		return placeholder
+	})
+}
+
+// replaceJSONVariables returns a copy of the json value v with placeholders in its strings replaced with vars
+func replaceJSONVariables(v interface{}, vars map[string]string) interface{} {
+	switch value := v.(type) {
+	case string:
+		return replaceVariables(value, vars)
+	case map[string]interface{}:
+		m := map[string]interface{}{}
+		for k, item := range value {
+			m[k] = replaceJSONVariables(item, vars)
+		}
+
+		return m
+	case []interface{}:
+		items := make([]interface{}, len(value))
+		for i, item := range value {
+			items[i] = replaceJSONVariables(item, vars)
+		}
+
+		return items
+	}
+
+	return v
+}
+
+// jsonValue converts maps decoded from yaml (with interface{} keys) so they can be encoded as json
+func jsonValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for k, item := range value {
+			m[fmt.Sprint(k)] = jsonValue(item)
+		}
+
+		return m
+	case map[string]interface{}:
+		m := map[string]interface{}{}
+		for k, item := range value {
+			m[k] = jsonValue(item)
+		}
+
+		return m
+	case []interface{}:
+		items := make([]interface{}, len(value))
+		for i, item := range value {
+			items[i] = jsonValue(item)
+		}
+
+		return items
+	}
+
+	return v
+}
@@ -0,0 +1,65 @@
+package cachet
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestHTTPRequestBody(t *testing.T) {
+	r := HTTPRequest{
+		Method: "post",
+		JSON:   map[interface{}]interface{}{"user": "monitor", "tags": []interface{}{"a"}},
+	}
+	if errs := r.Validate(""); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	req, _ := r.NewRequest("http://example.com/login", nil)
+	body, _ := ioutil.ReadAll(req.Body)
+	if req.Method != "POST" || string(body) != `{"tags":["a"],"user":"monitor"}` || req.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected json request: %s %s %s", req.Method, body, req.Header.Get("Content-Type"))
+	}
+
+	// captured values are escaped
+	r = HTTPRequest{Method: "post", JSON: map[interface{}]interface{}{"token": "{token}", "ids": []interface{}{"{id}", 1}}}
+	if errs := r.Validate(""); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	req, _ = r.NewRequest("http://example.com/profile", map[string]string{"token": `a", "admin": true, "x": "\`, "id": "7"})
+	body, _ = ioutil.ReadAll(req.Body)
+	if string(body) != `{"ids":["7",1],"token":"a\", \"admin\": true, \"x\": \"\\"}` {
+		t.Errorf("unexpected json body: %s", body)
+	}
+
+	secret, _ := ioutil.TempFile("", "secret")
+	defer os.Remove(secret.Name())
+	secret.WriteString("hunter2\n")
+	secret.Close()
+
+	r = HTTPRequest{
+		Form:      map[string]string{"user": "monitor", "password": "file:" + secret.Name()},
+		BasicAuth: &BasicAuth{Username: "admin", Password: "file:" + secret.Name()},
+		Headers:   map[string]string{"Content-Type": "application/x-custom"},
+	}
+	if errs := r.Validate(""); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	req, _ = r.NewRequest("http://example.com/login", map[string]string{"unused": "x"})
+	body, _ = ioutil.ReadAll(req.Body)
+	username, password, _ := req.BasicAuth()
+	if string(body) != "password=hunter2&user=monitor" || username != "admin" || password != "hunter2" {
+		t.Errorf("unexpected form request: %s %s:%s", body, username, password)
+	}
+
+	if req.Header.Get("Content-Type") != "application/x-custom" {
+		t.Error("headers should override the content type")
+	}
+
+	r = HTTPRequest{Body: "x", JSON: "y"}
+	if errs := r.Validate(""); len(errs) != 1 {
+		t.Errorf("expected an error for two bodies, got %v", errs)
+	}
+}
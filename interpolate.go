@@ -0,0 +1,127 @@
+package cachet
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// matches $${ (escaped) and ${VAR} / ${VAR:-default}
+var envPattern = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// interpolateEnv replaces ${VAR} and ${VAR:-default} in the string values of parsed configuration with
+// environment variables, so values are never re-parsed and comments are left alone. $${ is kept as a literal ${.
+// Unset variables without a default are reported by the key path of their value.
+func interpolateEnv(path string, value interface{}) (interface{}, []ConfigError) {
+	errs := []ConfigError{}
+
+	switch v := value.(type) {
+	case string:
+		result, missing := interpolateString(v)
+		for _, name := range missing {
+			errs = append(errs, ConfigError{Path: path, Message: "Environment variable " + name + " is not set"})
+		}
+
+		return result, errs
+	case map[string]interface{}:
+		for k, item := range v {
+			var itemErrs []ConfigError
+			v[k], itemErrs = interpolateEnv(joinKey(path, k), item)
+			errs = append(errs, itemErrs...)
+		}
+	case map[interface{}]interface{}:
+		for k, item := range v {
+			var itemErrs []ConfigError
+			v[k], itemErrs = interpolateEnv(joinKey(path, fmt.Sprint(k)), item)
+			errs = append(errs, itemErrs...)
+		}
+	case []interface{}:
+		for i, item := range v {
+			var itemErrs []ConfigError
+			v[i], itemErrs = interpolateEnv(fmt.Sprintf("%s[%d]", path, i), item)
+			errs = append(errs, itemErrs...)
+		}
+	}
+
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Path < errs[j].Path })
+
+	return value, errs
+}
+
+// interpolateString substitutes environment variables in s, returning the names of unset variables
+func interpolateString(s string) (string, []string) {
+	missing := []string{}
+
+	result := envPattern.ReplaceAllStringFunc(s, func(match string) string {
+		if match == "$${" {
+			return "${"
+		}
+
+		groups := envPattern.FindStringSubmatch(match)
+		if value := os.Getenv(groups[1]); len(value) > 0 {
+			return value
+		}
+
+		if len(groups[2]) > 0 {
+			// ${VAR:-default}
+			return groups[3]
+		}
+
+		if _, ok := os.LookupEnv(groups[1]); !ok {
+			missing = append(missing, groups[1])
+		}
+
+		return ""
+	})
+
+	return result, missing
+}
+
+// joinKey appends key to path, paths of included files end with ":"
+func joinKey(path, key string) string {
+	if len(path) == 0 || strings.HasSuffix(path, ":") {
+		return path + key
+	}
+
+	return path + "." + key
+}
+
+// ResolveSecret returns the contents of the file referenced by "file:PATH" values (without trailing newlines),
+// other values are returned as is
+func ResolveSecret(value string) (string, error) {
+	return resolveSecret("", value)
+}
+
+// resolveSecret is ResolveSecret with relative paths resolved against dir
+func resolveSecret(dir, value string) (string, error) {
+	if !strings.HasPrefix(value, "file:") {
+		return value, nil
+	}
+
+	data, err := ioutil.ReadFile(joinPath(dir, strings.TrimPrefix(value, "file:")))
+	if err != nil {
+		return "", fmt.Errorf("Cannot read secret: %v", err)
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// resolveSecrets resolves file: references in the values of headers, relative to dir
+func resolveSecrets(dir string, headers map[string]string) []string {
+	errs := []string{}
+
+	for k, v := range headers {
+		secret, err := resolveSecret(dir, v)
+		if err != nil {
+			errs = append(errs, "Header "+k+": "+err.Error())
+			continue
+		}
+
+		headers[k] = secret
+	}
+
+	return errs
+}
@@ -0,0 +1,87 @@
+package cachet
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInterpolateEnv(t *testing.T) {
+	os.Setenv("CACHET_MONITOR_TEST_TOKEN", `ab"cd #ef\`)
+	os.Setenv("CACHET_MONITOR_TEST_EMPTY", "")
+	os.Setenv("CACHET_MONITOR_TEST_INTERVAL", "30")
+	os.Unsetenv("CACHET_MONITOR_TEST_UNSET")
+
+	configs := map[string]string{
+		"config.json": `{
+	"api": {"url": "${CACHET_MONITOR_TEST_UNSET:-https://demo.cachethq.io}", "token": "${CACHET_MONITOR_TEST_TOKEN}"},
+	"system_name": "$${CACHET_MONITOR_TEST_TOKEN}",
+	"region": "${CACHET_MONITOR_TEST_EMPTY}",
+	"monitors": [{"name": "web", "target": "https://example.com", "interval": "${CACHET_MONITOR_TEST_INTERVAL}"}]
+}`,
+		"config.yaml": `# the token is read from ${CACHET_MONITOR_TEST_UNSET}
+api:
+  url: ${CACHET_MONITOR_TEST_UNSET:-https://demo.cachethq.io}
+  token: ${CACHET_MONITOR_TEST_TOKEN} # comment
+system_name: $${CACHET_MONITOR_TEST_TOKEN}
+region: "${CACHET_MONITOR_TEST_EMPTY}"
+monitors:
+  - name: web
+    target: https://example.com
+    interval: ${CACHET_MONITOR_TEST_INTERVAL}
+`,
+	}
+
+	for path, data := range configs {
+		cfg, errs := ParseConfig([]byte(data), path)
+		if cfg == nil || len(errs) > 0 {
+			t.Errorf("%s: unexpected errors %v", path, errs)
+			continue
+		}
+
+		if cfg.API.Token != `ab"cd #ef\` || cfg.API.URL != "https://demo.cachethq.io" {
+			t.Errorf("%s: unexpected api %+v", path, cfg.API)
+		}
+
+		if cfg.SystemName != "${CACHET_MONITOR_TEST_TOKEN}" || cfg.Region != "" {
+			t.Errorf("%s: unexpected system name %q, region %q", path, cfg.SystemName, cfg.Region)
+		}
+
+		if interval := cfg.Monitors[0].GetMonitor().Interval; interval != 30 {
+			t.Errorf("%s: expected interval 30, got %v", path, interval)
+		}
+	}
+
+	_, errs := ParseConfig([]byte(`{
+	"api": {"token": "${CACHET_MONITOR_TEST_UNSET}"},
+	"monitors": [{"name": "web", "headers": {"Authorization": "Bearer ${CACHET_MONITOR_TEST_UNSET}"}}]
+}`), "config.json")
+
+	if len(errs) != 2 || errs[0].Path != "api.token" || errs[1].Path != "monitors[0].headers.Authorization" {
+		t.Errorf("expected unset variables to be reported by key, got %v", errs)
+	}
+}
+
+func TestResolveSecret(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cachet-monitor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "token")
+	ioutil.WriteFile(path, []byte("secret\n"), 0600)
+
+	if secret, err := ResolveSecret("file:" + path); err != nil || secret != "secret" {
+		t.Errorf("expected secret from file, got %q (%v)", secret, err)
+	}
+
+	if value, _ := ResolveSecret("plain"); value != "plain" {
+		t.Errorf("plain values should be returned as is, got %q", value)
+	}
+
+	if _, err := ResolveSecret("file:" + filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected missing secret file to fail")
+	}
+}
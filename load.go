@@ -0,0 +1,625 @@
+package cachet
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"gopkg.in/yaml.v2"
+)
+
+// MonitorTypes creates an empty monitor for each monitor `type`
+var MonitorTypes = map[string]func() MonitorInterface{
+	"http":      func() MonitorInterface { return &HTTPMonitor{} },
+	"http_flow": func() MonitorInterface { return &HTTPFlowMonitor{} },
+	"dns":       func() MonitorInterface { return &DNSMonitor{} },
+}
+
+// NotifierTypes creates an empty notifier for each notifier `type`
+var NotifierTypes = map[string]func() NotifierInterface{
+	"webhook": func() NotifierInterface { return &WebhookNotifier{} },
+	"slack":   func() NotifierInterface { return &SlackNotifier{} },
+	"email":   func() NotifierInterface { return &EmailNotifier{} },
+}
+
+// matches the field name in mapstructure errors
+var decodeErrorField = regexp.MustCompile(`'([^']+)'`)
+
+// includeFile is the format of files included from the main configuration
+type includeFile struct {
+	// merged into every monitor of the file
+	Defaults map[string]interface{}   `json:"defaults" yaml:"defaults"`
+	Monitors []map[string]interface{} `json:"monitors" yaml:"monitors"`
+}
+
+// ParseConfig parses configuration, json or yaml depending on the extension of path, and decodes monitors
+// and notifiers. ${VAR} and ${VAR:-default} in string values are replaced with environment variables.
+// Monitors are also read from included files, relative include paths are resolved against the directory of path.
+// Monitors or notifiers which fail to decode are left out and reported. Unknown keys are reported with Unknown set.
+func ParseConfig(data []byte, path string) (*CachetMonitor, []ConfigError) {
+	var cfg CachetMonitor
+
+	cfg.dir = filepath.Dir(path)
+
+	raw, errs, err := unmarshalConfig(data, path, "", &cfg)
+	if err != nil {
+		return nil, []ConfigError{{Path: "config", Message: "Unable to parse configuration: " + err.Error()}}
+	}
+
+	errs = append(errs, unknownKeys("", raw, reflect.TypeOf(&cfg).Elem(), configTagKey(path))...)
+	errs = append(errs, unknownDefaults("defaults", cfg.Defaults)...)
+
+	for index, rawMonitor := range cfg.RawMonitors {
+		monitors, monitorErrs := cfg.decodeMonitors(fmt.Sprintf("monitors[%d]", index), rawMonitor, nil)
+		cfg.Monitors = append(cfg.Monitors, monitors...)
+		errs = append(errs, monitorErrs...)
+	}
+
+	for _, pattern := range cfg.Include {
+		files, err := includedFiles(cfg.dir, pattern)
+		if err != nil {
+			errs = append(errs, ConfigError{Path: "include", Message: err.Error()})
+			continue
+		}
+
+		for _, file := range files {
+			monitors, includeErrs := cfg.parseInclude(file)
+			cfg.Monitors = append(cfg.Monitors, monitors...)
+			errs = append(errs, includeErrs...)
+		}
+	}
+
+	for index, rawNotifier := range cfg.RawNotifiers {
+		notifier, notifierErrs := decodeNotifier(fmt.Sprintf("notifiers[%d]", index), rawNotifier)
+		errs = append(errs, notifierErrs...)
+
+		if notifier != nil {
+			cfg.Notifiers = append(cfg.Notifiers, notifier)
+		}
+	}
+
+	errs = append(errs, duplicateMonitors(cfg.Monitors)...)
+
+	return &cfg, errs
+}
+
+// parseInclude reads monitors from an included file, applying the file's defaults
+func (cfg *CachetMonitor) parseInclude(file string) ([]MonitorInterface, []ConfigError) {
+	var include includeFile
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, []ConfigError{{Path: file, Message: err.Error()}}
+	}
+
+	raw, errs, err := unmarshalConfig(data, file, file+":", &include)
+	if err != nil {
+		return nil, append(errs, ConfigError{Path: file, Message: "Unable to parse configuration: " + err.Error()})
+	}
+
+	errs = append(errs, unknownKeys(file+":", raw, reflect.TypeOf(include), configTagKey(file))...)
+	errs = append(errs, unknownDefaults(file+":defaults", include.Defaults)...)
+
+	monitors := []MonitorInterface{}
+	for index, rawMonitor := range include.Monitors {
+		path := fmt.Sprintf("%s:monitors[%d]", file, index)
+		expanded, monitorErrs := cfg.decodeMonitors(path, rawMonitor, include.Defaults)
+		monitors = append(monitors, expanded...)
+		errs = append(errs, monitorErrs...)
+	}
+
+	return monitors, errs
+}
+
+// joinPath resolves relative paths against dir, the directory of the configuration file
+func joinPath(dir, path string) string {
+	if len(path) == 0 || len(dir) == 0 || filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(dir, path)
+}
+
+// includedFiles returns files matching pattern, or all configuration files when pattern is a directory
+func includedFiles(dir, pattern string) ([]string, error) {
+	pattern = joinPath(dir, pattern)
+
+	if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+		files := []string{}
+		for _, ext := range []string{"*.json", "*.yaml", "*.yml"} {
+			matches, _ := filepath.Glob(filepath.Join(pattern, ext))
+			files = append(files, matches...)
+		}
+
+		sort.Strings(files)
+		return files, nil
+	}
+
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("No files match %q", pattern)
+	}
+
+	return files, nil
+}
+
+// duplicateMonitors reports monitors sharing a name
+func duplicateMonitors(monitors []MonitorInterface) []ConfigError {
+	errs := []ConfigError{}
+	paths := map[string]string{}
+
+	for _, monitor := range monitors {
+		mon := monitor.GetMonitor()
+		if len(mon.Name) == 0 {
+			continue
+		}
+
+		if path, ok := paths[mon.Name]; ok {
+			errs = append(errs, ConfigError{Path: mon.configPath, Name: mon.Name, Message: "Duplicate monitor name, already defined in " + path})
+			continue
+		}
+
+		paths[mon.Name] = mon.configPath
+	}
+
+	return errs
+}
+
+// decodeMonitors applies the profiles raw extends, fileDefaults and the configuration defaults (in that order
+// of precedence) to raw, expands its targets and decodes the resulting monitors. Defaults only set keys
+// declared by the monitor's type.
+func (cfg *CachetMonitor) decodeMonitors(path string, raw map[string]interface{}, fileDefaults map[string]interface{}) ([]MonitorInterface, []ConfigError) {
+	name, _ := raw["name"].(string)
+
+	profile, err := cfg.resolveProfiles(raw["extend"], nil)
+	if err != nil {
+		return nil, []ConfigError{{Path: path + ".extend", Name: name, Message: err.Error()}}
+	}
+
+	raw = mergeDefaults(raw, profile)
+	raw = mergeDefaults(raw, typeDefaults(raw, fileDefaults))
+	raw = mergeDefaults(raw, typeDefaults(raw, cfg.Defaults))
+
+	if _, ok := raw["extend"]; ok {
+		// decoded as a list
+		raw["extend"], _ = extendNames(raw["extend"])
+	}
+
+	if _, ok := raw["discover"]; ok {
+		return cfg.discoverMonitors(path, raw)
+	}
+
+	expanded, errs := expandTargets(path, raw)
+
+	monitors := []MonitorInterface{}
+	for _, target := range expanded {
+		monitor, monitorErrs := decodeMonitor(target.path, target.raw)
+		errs = append(errs, monitorErrs...)
+
+		if monitor != nil {
+			monitors = append(monitors, monitor)
+		}
+	}
+
+	return monitors, errs
+}
+
+// resolveProfiles merges the profiles named by extend (a name or list of names), later profiles taking
+// precedence. Profiles can extend other profiles, seen holds the chain to detect cycles.
+func (cfg *CachetMonitor) resolveProfiles(extend interface{}, seen []string) (map[string]interface{}, error) {
+	names, err := extendNames(extend)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := map[string]interface{}{}
+	for _, name := range names {
+		for _, s := range seen {
+			if s == name {
+				return nil, fmt.Errorf("Profile cycle: %s -> %s", strings.Join(seen, " -> "), name)
+			}
+		}
+
+		profile, ok := cfg.Profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown profile %q", name)
+		}
+
+		parent, err := cfg.resolveProfiles(profile["extend"], append(seen, name))
+		if err != nil {
+			return nil, err
+		}
+
+		values := map[string]interface{}{}
+		for k, v := range profile {
+			if k != "extend" {
+				values[k] = v
+			}
+		}
+
+		merged = mergeDefaults(mergeDefaults(values, parent), merged)
+	}
+
+	return merged, nil
+}
+
+// extendNames returns the profile names of an `extend` value
+func extendNames(extend interface{}) ([]string, error) {
+	switch value := extend.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{value}, nil
+	case []string:
+		return value, nil
+	case []interface{}:
+		names := []string{}
+		for _, name := range value {
+			s, ok := name.(string)
+			if !ok {
+				return nil, fmt.Errorf("Profile names must be strings, got %v", name)
+			}
+
+			names = append(names, s)
+		}
+
+		return names, nil
+	}
+
+	return nil, fmt.Errorf("Expected a profile name or list of profile names, got %v", extend)
+}
+
+// typeDefaults returns the defaults declared by the type of monitor raw (or the defaults) sets, so type specific
+// defaults like expected_status_code are not applied to other types. Unknown types get every default. Keys no type
+// declares are left out here and reported by unknownDefaults.
+func typeDefaults(raw map[string]interface{}, defaults map[string]interface{}) map[string]interface{} {
+	monType, ok := raw["type"].(string)
+	if !ok {
+		monType, _ = defaults["type"].(string)
+	}
+
+	newMonitor, ok := MonitorTypes[GetMonitorType(monType)]
+	if !ok || len(defaults) == 0 {
+		return defaults
+	}
+
+	fields := map[string]reflect.StructField{}
+	addStructFields(fields, reflect.TypeOf(newMonitor()).Elem(), "mapstructure")
+
+	declared := map[string]interface{}{}
+	for k, v := range defaults {
+		if _, ok := fields[strings.ToLower(k)]; ok {
+			declared[k] = v
+		}
+	}
+
+	return declared
+}
+
+// unknownDefaults reports the defaults at path which no monitor type declares
+func unknownDefaults(path string, defaults map[string]interface{}) []ConfigError {
+	fields := map[string]reflect.StructField{}
+	for _, newMonitor := range MonitorTypes {
+		addStructFields(fields, reflect.TypeOf(newMonitor()).Elem(), "mapstructure")
+	}
+
+	keys := []string{}
+	for key := range defaults {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	errs := []ConfigError{}
+	for _, key := range keys {
+		if _, ok := fields[strings.ToLower(key)]; !ok {
+			errs = append(errs, ConfigError{Path: joinKey(path, key), Message: "Unknown key", Unknown: true})
+		}
+	}
+
+	return errs
+}
+
+// mergeDefaults returns raw with keys missing from it set from defaults. Nested objects are merged the same way.
+func mergeDefaults(raw map[string]interface{}, defaults map[string]interface{}) map[string]interface{} {
+	if len(defaults) == 0 {
+		return raw
+	}
+
+	merged := map[string]interface{}{}
+	for k, v := range defaults {
+		merged[k] = v
+	}
+
+	for k, v := range raw {
+		value, isMap := toStringMap(v)
+		defaultValue, defaultIsMap := toStringMap(merged[k])
+		if isMap && defaultIsMap {
+			merged[k] = mergeDefaults(value, defaultValue)
+			continue
+		}
+
+		merged[k] = v
+	}
+
+	return merged
+}
+
+// unmarshalConfig parses data (json, or yaml by extension of path), interpolates environment variables into
+// its string values (reported under prefix) and decodes the result into v. Returns the interpolated values.
+func unmarshalConfig(data []byte, path, prefix string, v interface{}) (map[string]interface{}, []ConfigError, error) {
+	var raw map[string]interface{}
+	if isYAML(path) {
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, nil, err
+		}
+	} else if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, nil, err
+	}
+
+	_, errs := interpolateEnv(prefix, raw)
+
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.DecodeHookFuncKind(stringToValue),
+		Squash:     true,
+		TagName:    configTagKey(path),
+		Result:     v,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := decoder.Decode(raw); err != nil {
+		return nil, nil, err
+	}
+
+	return raw, errs, nil
+}
+
+// stringToValue converts strings decoded into boolean and number fields, so they can be set from
+// environment variables
+func stringToValue(from, to reflect.Kind, data interface{}) (interface{}, error) {
+	s, ok := data.(string)
+	if from != reflect.String || !ok {
+		return data, nil
+	}
+
+	switch to {
+	case reflect.Bool:
+		if value, err := strconv.ParseBool(s); err == nil {
+			return value, nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if value, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return value, nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if value, err := strconv.ParseUint(s, 10, 64); err == nil {
+			return value, nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if value, err := strconv.ParseFloat(s, 64); err == nil {
+			return value, nil
+		}
+	}
+
+	return data, nil
+}
+
+func isYAML(path string) bool {
+	return strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml")
+}
+
+// configTagKey returns the struct tag naming keys in the file at path
+func configTagKey(path string) string {
+	if isYAML(path) {
+		return "yaml"
+	}
+
+	return "json"
+}
+
+// decodeMonitor decodes raw into a monitor of its `type`. Returns nil if it could not be decoded.
+func decodeMonitor(path string, raw map[string]interface{}) (MonitorInterface, []ConfigError) {
+	name, _ := raw["name"].(string)
+
+	// get default type
+	monType := GetMonitorType("")
+	if t, ok := raw["type"].(string); ok {
+		monType = GetMonitorType(t)
+	}
+
+	newMonitor, ok := MonitorTypes[monType]
+	if !ok {
+		return nil, []ConfigError{{Path: path + ".type", Name: name, Message: "Invalid monitor type: " + monType}}
+	}
+
+	monitor := newMonitor()
+	errs := decode(path, name, raw, monitor)
+	monitor.GetMonitor().Type = monType
+	monitor.GetMonitor().configPath = path
+
+	if hasErrors(errs) {
+		return nil, errs
+	}
+
+	return monitor, errs
+}
+
+// decodeNotifier decodes raw into a notifier of its `type`. Returns nil if it could not be decoded.
+func decodeNotifier(path string, raw map[string]interface{}) (NotifierInterface, []ConfigError) {
+	name, _ := raw["name"].(string)
+
+	notifierType := ""
+	if t, ok := raw["type"].(string); ok {
+		notifierType = GetNotifierType(t)
+	}
+
+	newNotifier, ok := NotifierTypes[notifierType]
+	if !ok {
+		return nil, []ConfigError{{Path: path + ".type", Name: name, Message: "Invalid notifier type: " + notifierType}}
+	}
+
+	notifier := newNotifier()
+	errs := decode(path, name, raw, notifier)
+	notifier.GetNotifier().Type = notifierType
+	notifier.GetNotifier().configPath = path
+
+	if hasErrors(errs) {
+		return nil, errs
+	}
+
+	return notifier, errs
+}
+
+// decode raw into result with mapstructure, reporting decode errors and unused keys
+func decode(path, name string, raw map[string]interface{}, result interface{}) []ConfigError {
+	errs := []ConfigError{}
+
+	var md mapstructure.Metadata
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.DecodeHookFuncKind(stringToValue),
+		Metadata:   &md,
+		Result:     result,
+	})
+	if err != nil {
+		return append(errs, ConfigError{Path: path, Name: name, Message: err.Error()})
+	}
+
+	if err := decoder.Decode(raw); err != nil {
+		messages := []string{err.Error()}
+		if decodeErr, ok := err.(*mapstructure.Error); ok {
+			messages = decodeErr.Errors
+		}
+
+		for _, message := range messages {
+			fieldPath := path
+			if match := decodeErrorField.FindStringSubmatch(message); match != nil {
+				fieldPath += "." + strings.ToLower(match[1])
+			}
+
+			errs = append(errs, ConfigError{Path: fieldPath, Name: name, Message: message})
+		}
+	}
+
+	sort.Strings(md.Unused)
+	for _, key := range md.Unused {
+		errs = append(errs, ConfigError{Path: path + "." + strings.ToLower(key), Name: name, Message: "Unknown key", Unknown: true})
+	}
+
+	return errs
+}
+
+// unknownKeys reports keys of raw which do not match a field of struct type t
+func unknownKeys(path string, raw map[string]interface{}, t reflect.Type, tagKey string) []ConfigError {
+	errs := []ConfigError{}
+
+	fields := map[string]reflect.StructField{}
+	addStructFields(fields, t, tagKey)
+
+	keys := []string{}
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		keyPath := joinKey(path, key)
+
+		field, ok := fields[strings.ToLower(key)]
+		if !ok {
+			errs = append(errs, ConfigError{Path: keyPath, Message: "Unknown key", Unknown: true})
+			continue
+		}
+
+		switch {
+		case field.Type.Kind() == reflect.Struct:
+			if value, ok := toStringMap(raw[key]); ok {
+				errs = append(errs, unknownKeys(keyPath, value, field.Type, tagKey)...)
+			}
+		case field.Type.Kind() == reflect.Map && field.Type.Elem().Kind() == reflect.Struct:
+			values, _ := toStringMap(raw[key])
+			names := []string{}
+			for name := range values {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			for _, name := range names {
+				if value, ok := toStringMap(values[name]); ok {
+					errs = append(errs, unknownKeys(keyPath+"."+name, value, field.Type.Elem(), tagKey)...)
+				}
+			}
+		}
+	}
+
+	return errs
+}
+
+// addStructFields adds the fields of t by lowercased key. Fields of embedded structs without a key are added
+// as fields of t, like json and yaml `inline` do.
+func addStructFields(fields map[string]reflect.StructField, t reflect.Type, tagKey string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get(tagKey), ",")
+		key := tag[0]
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && len(key) == 0 {
+			addStructFields(fields, field.Type, tagKey)
+			continue
+		}
+
+		if len(field.PkgPath) > 0 {
+			// unexported
+			continue
+		}
+
+		if key == "-" {
+			continue
+		}
+		if len(key) == 0 {
+			key = field.Name
+		}
+
+		fields[strings.ToLower(key)] = field
+	}
+}
+
+// toStringMap converts json and yaml objects to map[string]interface{}
+func toStringMap(v interface{}) (map[string]interface{}, bool) {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(m))
+		for k, value := range m {
+			converted[fmt.Sprint(k)] = value
+		}
+
+		return converted, true
+	}
+
+	return nil, false
+}
+
+// hasErrors returns true if errs contains anything but unknown keys
+func hasErrors(errs []ConfigError) bool {
+	for _, err := range errs {
+		if !err.Unknown {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,205 @@
+package cachet
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// placeholderPattern matches {name} placeholders in expanded monitor fields
+var placeholderPattern = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandedFields may hold placeholders
+var expandedFields = []string{"name", "target", "component_id", "metric_id"}
+
+// expandedMonitor is one monitor expanded from a definition with targets or a matrix
+type expandedMonitor struct {
+	// path locates the expansion, eg. monitors[0].targets[2]
+	path string
+	raw  map[string]interface{}
+}
+
+// expandTargets expands the monitor definition at path into a monitor per entry of `targets`, or per
+// combination of `matrix` values. Definitions without either are returned as is.
+func expandTargets(path string, raw map[string]interface{}) ([]expandedMonitor, []ConfigError) {
+	name, _ := raw["name"].(string)
+	_, hasTargets := raw["targets"]
+	_, hasMatrix := raw["matrix"]
+
+	if hasTargets && hasMatrix {
+		return nil, []ConfigError{{Path: path, Name: name, Message: "Cannot use both targets and matrix"}}
+	}
+
+	var variables []map[string]string
+	var paths []string
+	var err error
+
+	switch {
+	case hasTargets:
+		variables, err = targetVariables(raw["targets"])
+		for i := range variables {
+			paths = append(paths, fmt.Sprintf("targets[%d]", i))
+		}
+	case hasMatrix:
+		variables, err = matrixVariables(raw["matrix"])
+		for _, vars := range variables {
+			paths = append(paths, "matrix"+formatVariables(vars))
+		}
+	default:
+		return []expandedMonitor{{path: path, raw: raw}}, nil
+	}
+
+	if err != nil {
+		return nil, []ConfigError{{Path: path, Name: name, Message: err.Error()}}
+	}
+
+	monitors := []expandedMonitor{}
+	errs := []ConfigError{}
+	for i, vars := range variables {
+		expanded, field, err := expandMonitor(raw, vars)
+		if err != nil {
+			errs = append(errs, ConfigError{Path: path + "." + paths[i] + "." + field, Name: name, Message: err.Error()})
+			continue
+		}
+
+		monitors = append(monitors, expandedMonitor{path: path + "." + paths[i], raw: expanded})
+	}
+
+	return monitors, errs
+}
+
+// targetVariables returns the variables of each target. Targets are strings, available as {target},
+// or objects of variables.
+func targetVariables(value interface{}) ([]map[string]string, error) {
+	targets, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("targets: expected a list")
+	}
+
+	variables := []map[string]string{}
+	for i, target := range targets {
+		if s, ok := target.(string); ok {
+			variables = append(variables, map[string]string{"target": s})
+			continue
+		}
+
+		values, ok := toStringMap(target)
+		if !ok {
+			return nil, fmt.Errorf("targets[%d]: expected a string or an object", i)
+		}
+
+		vars := map[string]string{}
+		for k, v := range values {
+			vars[k] = fmt.Sprint(v)
+		}
+
+		variables = append(variables, vars)
+	}
+
+	return variables, nil
+}
+
+// matrixVariables returns every combination of the matrix values, in key order
+func matrixVariables(value interface{}) ([]map[string]string, error) {
+	matrix, ok := toStringMap(value)
+	if !ok {
+		return nil, fmt.Errorf("matrix: expected an object of lists")
+	}
+
+	keys := []string{}
+	for k := range matrix {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	variables := []map[string]string{{}}
+	for _, key := range keys {
+		values, ok := matrix[key].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("matrix.%s: expected a list", key)
+		}
+
+		combinations := []map[string]string{}
+		for _, vars := range variables {
+			for _, v := range values {
+				combination := map[string]string{key: fmt.Sprint(v)}
+				for k, existing := range vars {
+					combination[k] = existing
+				}
+
+				combinations = append(combinations, combination)
+			}
+		}
+
+		variables = combinations
+	}
+
+	return variables, nil
+}
+
+// expandMonitor returns a copy of raw with placeholders replaced by vars. When raw has no target,
+// {target} is used. On error, the field holding the problem is returned.
+func expandMonitor(raw map[string]interface{}, vars map[string]string) (map[string]interface{}, string, error) {
+	expanded := map[string]interface{}{}
+	for k, v := range raw {
+		if k != "targets" && k != "matrix" {
+			expanded[k] = v
+		}
+	}
+
+	if _, ok := expanded["target"]; !ok {
+		expanded["target"] = "{target}"
+	}
+
+	for _, field := range expandedFields {
+		text, ok := expanded[field].(string)
+		if !ok {
+			continue
+		}
+
+		var missing []string
+		text = placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+			key := placeholder[1 : len(placeholder)-1]
+			value, ok := vars[key]
+			if !ok {
+				missing = append(missing, key)
+			}
+
+			return value
+		})
+
+		if len(missing) > 0 {
+			return nil, field, fmt.Errorf("Unknown placeholder {%s}", strings.Join(missing, "}, {"))
+		}
+
+		expanded[field] = text
+		if field == "component_id" || field == "metric_id" {
+			id, err := strconv.Atoi(text)
+			if err != nil {
+				return nil, field, fmt.Errorf("Expected a number, got %q", text)
+			}
+
+			expanded[field] = id
+		}
+	}
+
+	return expanded, "", nil
+}
+
+// formatVariables formats vars as [key=value,...] in key order
+func formatVariables(vars map[string]string) string {
+	keys := []string{}
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := []string{}
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+vars[k])
+	}
+
+	return "[" + strings.Join(pairs, ",") + "]"
+}
@@ -0,0 +1,127 @@
+package cachet
+
+import (
+	"errors"
+	"net"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fail reason classes, used to label failure metrics
+const (
+	FailTimeout    = "timeout"
+	FailConnection = "connection"
+	FailStatusCode = "status_code"
+	FailBody       = "body"
+	FailHeader     = "header"
+	FailRedirect   = "redirect"
+	FailDNS        = "dns"
+	FailUnknown    = "unknown"
+)
+
+var (
+	monitorUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "cachet_monitor",
+		Name:      "up",
+		Help:      "Whether the last check of the monitor succeeded (1) or failed (0).",
+	}, []string{"monitor", "type"})
+
+	checkDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "cachet_monitor",
+		Name:      "check_duration_seconds",
+		Help:      "Duration of monitor checks.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"monitor", "type"})
+
+	checkFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cachet_monitor",
+		Name:      "check_failures_total",
+		Help:      "Failed checks by reason class.",
+	}, []string{"monitor", "type", "reason"})
+
+	incidentOpen = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "cachet_monitor",
+		Name:      "incident_open",
+		Help:      "Whether the monitor has an open incident.",
+	}, []string{"monitor"})
+
+	apiRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cachet_monitor",
+		Name:      "api_requests_total",
+		Help:      "Requests made to the Cachet API by method and response code.",
+	}, []string{"method", "code"})
+
+	apiErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cachet_monitor",
+		Name:      "api_errors_total",
+		Help:      "Cachet API requests which failed or returned a non-200 status code.",
+	}, []string{"method"})
+)
+
+func init() {
+	prometheus.MustRegister(monitorUp, checkDuration, checkFailures, incidentOpen, apiRequests, apiErrors)
+}
+
+// forgetMonitor removes the metrics of a monitor which was removed
+func forgetMonitor(mon *AbstractMonitor) {
+	monitorUp.DeleteLabelValues(mon.Name, mon.Type)
+	checkDuration.DeleteLabelValues(mon.Name, mon.Type)
+	checkFailures.DeletePartialMatch(prometheus.Labels{"monitor": mon.Name})
+	incidentOpen.DeleteLabelValues(mon.Name)
+}
+
+// recordCheck updates check metrics. lag is in milliseconds
+func recordCheck(mon *AbstractMonitor, up bool, lag int64) {
+	checkDuration.WithLabelValues(mon.Name, mon.Type).Observe(float64(lag) / 1000)
+
+	if up {
+		monitorUp.WithLabelValues(mon.Name, mon.Type).Set(1)
+		return
+	}
+
+	class := mon.lastFailClass
+	if len(class) == 0 {
+		class = FailUnknown
+	}
+
+	monitorUp.WithLabelValues(mon.Name, mon.Type).Set(0)
+	checkFailures.WithLabelValues(mon.Name, mon.Type, class).Inc()
+}
+
+// recordIncident updates the incident gauge of the monitor
+func recordIncident(mon *AbstractMonitor) {
+	open := 0.0
+	if mon.incident != nil {
+		open = 1
+	}
+
+	incidentOpen.WithLabelValues(mon.Name).Set(open)
+}
+
+// recordAPIRequest counts a cachet API request. code is 0 when the request failed
+func recordAPIRequest(method string, code int, err error) {
+	if err != nil {
+		apiRequests.WithLabelValues(method, "error").Inc()
+		apiErrors.WithLabelValues(method).Inc()
+		return
+	}
+
+	apiRequests.WithLabelValues(method, strconv.Itoa(code)).Inc()
+	if code != 200 {
+		apiErrors.WithLabelValues(method).Inc()
+	}
+}
+
+// errorClass classifies request errors as timeouts or connection failures
+func errorClass(err error) string {
+	if errors.Is(err, errTooManyRedirects) {
+		return FailRedirect
+	}
+
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return FailTimeout
+	}
+
+	return FailConnection
+}
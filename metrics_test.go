@@ -0,0 +1,83 @@
+package cachet
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRecordCheck(t *testing.T) {
+	mon := &AbstractMonitor{Name: "metrics", Type: "http"}
+
+	recordCheck(mon, true, 250)
+	if up := testutil.ToFloat64(monitorUp.WithLabelValues("metrics", "http")); up != 1 {
+		t.Errorf("expected up 1, got %v", up)
+	}
+
+	mon.setFailReason(FailTimeout, "timed out")
+	recordCheck(mon, false, 1000)
+	recordCheck(mon, false, 1000)
+	mon.setFailReason("", "")
+	recordCheck(mon, false, 1000)
+
+	if up := testutil.ToFloat64(monitorUp.WithLabelValues("metrics", "http")); up != 0 {
+		t.Errorf("expected up 0, got %v", up)
+	}
+
+	failures := map[string]float64{FailTimeout: 2, FailUnknown: 1}
+	for class, expected := range failures {
+		if count := testutil.ToFloat64(checkFailures.WithLabelValues("metrics", "http", class)); count != expected {
+			t.Errorf("expected %v %s failures, got %v", expected, class, count)
+		}
+	}
+
+	mon.incident = &Incident{}
+	recordIncident(mon)
+	if open := testutil.ToFloat64(incidentOpen.WithLabelValues("metrics")); open != 1 {
+		t.Errorf("expected open incident, got %v", open)
+	}
+
+	forgetMonitor(mon)
+	if checkFailures.DeleteLabelValues("metrics", "http", FailTimeout) || monitorUp.DeleteLabelValues("metrics", "http") {
+		t.Error("expected metrics of removed monitor to be forgotten")
+	}
+}
+
+func TestRecordAPIRequest(t *testing.T) {
+	// counters are global, PATCH is not used by the api client
+	recordAPIRequest("PATCH", 200, nil)
+	recordAPIRequest("PATCH", 500, nil)
+	recordAPIRequest("PATCH", 0, fmt.Errorf("connection refused"))
+
+	for code, expected := range map[string]float64{"200": 1, "500": 1, "error": 1} {
+		if count := testutil.ToFloat64(apiRequests.WithLabelValues("PATCH", code)); count != expected {
+			t.Errorf("expected %v requests with code %s, got %v", expected, code, count)
+		}
+	}
+
+	if count := testutil.ToFloat64(apiErrors.WithLabelValues("PATCH")); count != 2 {
+		t.Errorf("expected 2 api errors, got %v", count)
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestErrorClass(t *testing.T) {
+	tests := map[error]string{
+		net.Error(timeoutError{}):                              FailTimeout,
+		fmt.Errorf("%w: stopped after 3", errTooManyRedirects): FailRedirect,
+		fmt.Errorf("connection refused"):                       FailConnection,
+	}
+
+	for err, class := range tests {
+		if actual := errorClass(err); actual != class {
+			t.Errorf("%v: expected class %s, got %s", err, class, actual)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package cachet
 
 import (
+	"errors"
 	"sync"
 	"time"
 
@@ -23,6 +24,23 @@ type MonitorInterface interface {
 	Describe() []string
 }
 
+// LagStats of recent checks, in milliseconds
+type LagStats struct {
+	Last int64
+	Min  int64
+	Max  int64
+	Avg  int64
+}
+
+// CheckResult of a single check
+type CheckResult struct {
+	Up         bool
+	Lag        int64
+	FailReason string
+	// Metrics extracted by the check, by metric id
+	Metrics map[int]float64
+}
+
 // AbstractMonitor data model
 type AbstractMonitor struct {
 	Name   string
@@ -41,9 +59,18 @@ type AbstractMonitor struct {
 	// Templating stuff
 	Template struct {
 		Investigating MessageTemplate
+		Identified    MessageTemplate
+		Watching      MessageTemplate
 		Fixed         MessageTemplate
+		// posted when the fail reason changes while the incident is open
+		Update MessageTemplate
 	}
 
+	// names of notifiers to send incident transitions to (defaults to all)
+	Notifiers []string
+	// names of the profiles this monitor is based on
+	Extend []string
+
 	// Threshold = percentage / number of down incidents
 	Threshold      float32
 	ThresholdCount bool `mapstructure:"threshold_count"`
@@ -52,14 +79,36 @@ type AbstractMonitor struct {
 	// PerformanceThreshold sets the % limit above which this monitor will trigger degraded-performance
 	// PerformanceThreshold float32
 
-	history []bool
-	// lagHistory     []float32
+	history        []bool
+	lagHistory     []int64
+	failReasons    []string
 	lastFailReason string
-	incident       *Incident
-	config         *CachetMonitor
+	lastFailClass  string
+	// fail reason set by the running check, becomes lastFailReason once the check is analysed
+	checkFailReason string
+	// values extracted by the last check, by metric id
+	metricValues map[int]float64
+	incident     *Incident
+	config       *CachetMonitor
+
+	// component name, fetched from cachet for templates
+	componentName string
+	// location in the configuration, eg. monitors[2]
+	configPath string
+
+	// guards state read by the admin api and dashboard: pause, history, fail reasons and the incident.
+	// Never held during checks or status backend requests.
+	mu     sync.Mutex
+	paused bool
+	// serialises analysing checks and incident updates, which call the status backend
+	incidentMu sync.Mutex
 
 	// Closed when mon.Stop() is called
-	stopC chan bool
+	stopC    chan bool
+	stopOnce sync.Once
+	// Triggers an immediate check
+	checkC    chan bool
+	checkOnce sync.Once
 }
 
 func (mon *AbstractMonitor) Validate() []string {
@@ -88,11 +137,37 @@ func (mon *AbstractMonitor) Validate() []string {
 		mon.Threshold = 100
 	}
 
-	if err := mon.Template.Fixed.Compile(); err != nil {
-		errs = append(errs, "Could not compile \"fixed\" template: "+err.Error())
+	templates := []struct {
+		name string
+		tpl  *MessageTemplate
+	}{
+		{"investigating", &mon.Template.Investigating},
+		{"identified", &mon.Template.Identified},
+		{"watching", &mon.Template.Watching},
+		{"fixed", &mon.Template.Fixed},
+		{"update", &mon.Template.Update},
 	}
-	if err := mon.Template.Investigating.Compile(); err != nil {
-		errs = append(errs, "Could not compile \"investigating\" template: "+err.Error())
+	for _, t := range templates {
+		if err := t.tpl.Compile(mon.config, mon.Name+"."+t.name); err != nil {
+			errs = append(errs, "Could not compile \""+t.name+"\" template: "+err.Error())
+			continue
+		}
+
+		if mon.config == nil {
+			continue
+		}
+
+		if err := t.tpl.Test(getSampleTemplateData(mon)); err != nil {
+			errs = append(errs, "Could not render \""+t.name+"\" template with sample data: "+err.Error())
+		}
+	}
+
+	if mon.config != nil {
+		for _, name := range mon.Notifiers {
+			if mon.config.findNotifier(name) == nil {
+				errs = append(errs, "Unknown notifier: "+name)
+			}
+		}
 	}
 
 	return errs
@@ -112,8 +187,12 @@ func (mon *AbstractMonitor) Describe() []string {
 
 func (mon *AbstractMonitor) ClockStart(cfg *CachetMonitor, iface MonitorInterface, wg *sync.WaitGroup) {
 	wg.Add(1)
-	mon.config = cfg
-	mon.stopC = make(chan bool)
+	if mon.config == nil {
+		// normally set on validation, before the monitor can be reached by the admin api
+		mon.config = cfg
+	}
+	stopC := mon.stopChannel()
+	checkC := mon.checkChannel()
 	if cfg.Immediate {
 		mon.tick(iface)
 	}
@@ -123,29 +202,208 @@ func (mon *AbstractMonitor) ClockStart(cfg *CachetMonitor, iface MonitorInterfac
 		select {
 		case <-ticker.C:
 			mon.tick(iface)
-		case <-mon.stopC:
+		case <-checkC:
+			mon.tick(iface)
+		case <-stopC:
 			wg.Done()
 			return
 		}
 	}
 }
 
+// ClockStop stops checking, waiting for a running check to finish analysing. The incident is not changed by
+// checks once ClockStop returns.
 func (mon *AbstractMonitor) ClockStop() {
+	stopC := mon.stopChannel()
+
 	select {
-	case <-mon.stopC:
-		return
+	case <-stopC:
 	default:
-		close(mon.stopC)
+		close(stopC)
 	}
+
+	mon.incidentMu.Lock()
+	defer mon.incidentMu.Unlock()
+}
+
+// stopChannel returns the channel closed by ClockStop, which may be called before ClockStart
+func (mon *AbstractMonitor) stopChannel() chan bool {
+	mon.stopOnce.Do(func() {
+		mon.stopC = make(chan bool)
+	})
+
+	return mon.stopC
+}
+
+// checkChannel returns the channel Trigger schedules checks on, which may be called before ClockStart
+func (mon *AbstractMonitor) checkChannel() chan bool {
+	mon.checkOnce.Do(func() {
+		mon.checkC = make(chan bool, 1)
+	})
+
+	return mon.checkC
 }
 
 func (mon *AbstractMonitor) test() bool { return false }
 
+// Check runs a single check of the monitor, without recording history or sending anything to the status backend
+func Check(iface MonitorInterface) CheckResult {
+	mon := iface.GetMonitor()
+
+	mon.setFailReason("", "")
+	mon.metricValues = nil
+
+	reqStart := getMs()
+	up := iface.test()
+
+	return CheckResult{
+		Up:         up,
+		Lag:        getMs() - reqStart,
+		FailReason: mon.checkFailReason,
+		Metrics:    mon.metricValues,
+	}
+}
+
+// Trigger schedules an immediate check, unless one is already pending
+func (mon *AbstractMonitor) Trigger() {
+	select {
+	case mon.checkChannel() <- true:
+	default:
+	}
+}
+
+// Pause stops checks until Resume is called
+func (mon *AbstractMonitor) Pause() {
+	mon.mu.Lock()
+	defer mon.mu.Unlock()
+
+	mon.paused = true
+}
+
+// Resume continues checks of a paused monitor
+func (mon *AbstractMonitor) Resume() {
+	mon.mu.Lock()
+	defer mon.mu.Unlock()
+
+	mon.paused = false
+}
+
+// ResolveIncident resolves the open incident regardless of check history. It waits for a running check to
+// finish updating the incident, but not for the check itself.
+func (mon *AbstractMonitor) ResolveIncident() error {
+	mon.incidentMu.Lock()
+	defer mon.incidentMu.Unlock()
+
+	if mon.incident == nil {
+		return errors.New("Monitor has no open incident")
+	}
+
+	l := logrus.WithFields(logrus.Fields{
+		"monitor": mon.Name,
+		"time":    time.Now().Format(mon.config.DateFormat),
+	})
+	l.Warn("Force resolving incident")
+
+	mon.resolveIncident(l)
+	return nil
+}
+
+// setFailReason records why the running check failed, class groups reasons for metrics
+func (mon *AbstractMonitor) setFailReason(class, reason string) {
+	mon.lastFailClass = class
+	mon.checkFailReason = reason
+}
+
+// setMetricValue records a value extracted by a check, posted to metric id after the check
+func (mon *AbstractMonitor) setMetricValue(id int, value float64) {
+	if mon.metricValues == nil {
+		mon.metricValues = map[int]float64{}
+	}
+
+	mon.metricValues[id] = value
+}
+
+// sendMetric posts a data point, logging failures
+func (mon *AbstractMonitor) sendMetric(id int, value float64) {
+	if err := mon.config.StatusBackend.SendMetric(id, value); err != nil {
+		logrus.Warnf("Could not log metric! ID: %d, err: %v", id, err)
+	}
+}
+
+// getComponentName returns the name of the monitored component, fetched from cachet once
+func (mon *AbstractMonitor) getComponentName() string {
+	if len(mon.componentName) > 0 || mon.ComponentID == 0 {
+		return mon.componentName
+	}
+
+	component, err := mon.config.StatusBackend.GetComponent(mon.ComponentID)
+	if err != nil {
+		logrus.Warnf("cannot fetch component: %v", err)
+		return ""
+	}
+
+	mon.componentName = component.Name
+	return mon.componentName
+}
+
+// getLagStats summarises lag of the checks in history
+func (mon *AbstractMonitor) getLagStats() LagStats {
+	stats := LagStats{}
+	if len(mon.lagHistory) == 0 {
+		return stats
+	}
+
+	var sum int64
+	stats.Min = mon.lagHistory[0]
+	for _, lag := range mon.lagHistory {
+		sum += lag
+		if lag < stats.Min {
+			stats.Min = lag
+		}
+		if lag > stats.Max {
+			stats.Max = lag
+		}
+	}
+
+	stats.Last = mon.lagHistory[len(mon.lagHistory)-1]
+	stats.Avg = sum / int64(len(mon.lagHistory))
+
+	return stats
+}
+
 func (mon *AbstractMonitor) tick(iface MonitorInterface) {
+	mon.mu.Lock()
+	paused := mon.paused
+	mon.mu.Unlock()
+
+	if paused {
+		return
+	}
+
+	// the check runs without locks, so status requests are not blocked for its duration
+	mon.setFailReason("", "")
+	mon.metricValues = nil
 	reqStart := getMs()
 	up := iface.test()
 	lag := getMs() - reqStart
 
+	mon.incidentMu.Lock()
+	defer mon.incidentMu.Unlock()
+
+	select {
+	case <-mon.stopChannel():
+		// stopped during the check, the incident may have been resolved already
+		return
+	default:
+	}
+
+	recordCheck(mon, up, lag)
+
+	mon.mu.Lock()
+	if len(mon.checkFailReason) > 0 {
+		mon.lastFailReason = mon.checkFailReason
+	}
+
 	histSize := HistorySize
 	if mon.ThresholdCount {
 		histSize = int(mon.Threshold)
@@ -158,16 +416,35 @@ func (mon *AbstractMonitor) tick(iface MonitorInterface) {
 		mon.history = mon.history[len(mon.history)-(histSize-1):]
 	}
 	mon.history = append(mon.history, up)
+
+	if len(mon.lagHistory) >= histSize {
+		mon.lagHistory = mon.lagHistory[len(mon.lagHistory)-(histSize-1):]
+	}
+	mon.lagHistory = append(mon.lagHistory, lag)
+
+	if !up {
+		if len(mon.failReasons) >= HistorySize {
+			mon.failReasons = mon.failReasons[len(mon.failReasons)-(HistorySize-1):]
+		}
+		mon.failReasons = append(mon.failReasons, mon.lastFailReason)
+	}
+	mon.mu.Unlock()
+
 	mon.AnalyseData()
 
 	// report lag
 	if mon.MetricID > 0 {
-		go mon.config.API.SendMetric(mon.MetricID, lag)
+		go mon.sendMetric(mon.MetricID, float64(lag))
+	}
+
+	// report values extracted by the check
+	for id, value := range mon.metricValues {
+		go mon.sendMetric(id, value)
 	}
 }
 
-// TODO: test
-// AnalyseData decides if the monitor is statistically up or down and creates / resolves an incident
+// AnalyseData decides if the monitor is statistically up or down and creates / resolves an incident.
+// Called with incidentMu held.
 func (mon *AbstractMonitor) AnalyseData() {
 	// look at the past few incidents
 	numDown := 0
@@ -204,49 +481,119 @@ func (mon *AbstractMonitor) AnalyseData() {
 
 	if triggered && mon.incident == nil {
 		// create incident
-		tplData := getTemplateData(mon)
-		tplData["FailReason"] = mon.lastFailReason
-
-		subject, message := mon.Template.Investigating.Exec(tplData)
-		mon.incident = &Incident{
+		subject, message := mon.Template.Investigating.Exec(getTemplateData(mon))
+		incident := &Incident{
 			Name:        subject,
 			ComponentID: mon.ComponentID,
 			Message:     message,
 			Notify:      true,
+			failReason:  mon.lastFailReason,
+			startedAt:   time.Now(),
 		}
 
 		// is down, create an incident
 		l.Warnf("creating incident. Monitor is down: %v", mon.lastFailReason)
 		// set investigating status
-		mon.incident.SetInvestigating()
-		// create/update incident
-		if err := mon.incident.Send(mon.config); err != nil {
+		incident.SetInvestigating()
+		// create incident, which sets its id
+		if err := mon.config.StatusBackend.OpenIncident(incident); err != nil {
+			l.Printf("Error sending incident: %v", err)
+		}
+
+		mon.mu.Lock()
+		mon.incident = incident
+		mon.mu.Unlock()
+
+		recordIncident(mon)
+		mon.notify(EventOpen)
+		return
+	}
+
+	// no incident
+	if mon.incident == nil {
+		return
+	}
+
+	mon.incident.checks++
+
+	if mon.incident.ID == 0 && numDown > 0 {
+		// the backend failed when the incident was opened, retried while the monitor is down
+		l.Warn("Retrying to create incident")
+		incident := *mon.incident
+		if err := mon.config.StatusBackend.OpenIncident(&incident); err != nil {
 			l.Printf("Error sending incident: %v", err)
+			return
+		}
+
+		mon.mu.Lock()
+		mon.incident = &incident
+		mon.mu.Unlock()
+	}
+
+	if triggered {
+		if mon.incident.Status == 3 || (mon.incident.Status == 1 && mon.incident.checks >= histSize) {
+			// failing again while watching, or down for a whole history window since the incident was opened
+			l.Warn("Incident identified")
+			mon.incident.SetIdentified()
+			mon.sendIncidentUpdate(l, mon.Template.Identified)
+			mon.notify(EventEscalate)
+		} else if mon.lastFailReason != mon.incident.failReason {
+			l.Warnf("Updating incident. Monitor is down: %v", mon.lastFailReason)
+			mon.sendIncidentUpdate(l, mon.Template.Update)
 		}
 
 		return
 	}
 
-	// still triggered or no incident
-	if triggered || mon.incident == nil {
+	if numDown > 0 {
+		// below threshold, but not fully recovered yet
+		if mon.incident.Status != 3 {
+			l.Warn("Watching incident")
+			mon.incident.SetWatching()
+			mon.sendIncidentUpdate(l, mon.Template.Watching)
+		}
+
 		return
 	}
 
 	// was down, created an incident, its now ok, make it resolved.
 	l.Warn("Resolving incident")
+	mon.resolveIncident(l)
+}
 
-	// resolve incident
-	tplData := getTemplateData(mon)
-	tplData["incident"] = mon.incident
-
-	subject, message := mon.Template.Fixed.Exec(tplData)
-	mon.incident.Name = subject
-	mon.incident.Message = message
+// resolveIncident marks the open incident as fixed and resets failure state. Incidents the backend never
+// created are only resolved locally.
+func (mon *AbstractMonitor) resolveIncident(l *logrus.Entry) {
 	mon.incident.SetFixed()
-	if err := mon.incident.Send(mon.config); err != nil {
-		l.Printf("Error sending incident: %v", err)
+	if mon.incident.ID > 0 {
+		mon.sendIncidentUpdate(l, mon.Template.Fixed)
 	}
+	mon.notify(EventResolve)
 
+	mon.mu.Lock()
 	mon.lastFailReason = ""
+	mon.failReasons = nil
 	mon.incident = nil
+	mon.mu.Unlock()
+
+	recordIncident(mon)
+}
+
+// sendIncidentUpdate renders tpl and posts it as an update to the open incident
+func (mon *AbstractMonitor) sendIncidentUpdate(l *logrus.Entry, tpl MessageTemplate) {
+	_, message := tpl.Exec(getTemplateData(mon))
+
+	var err error
+	if mon.incident.Status == 4 {
+		// fixed
+		err = mon.config.StatusBackend.ResolveIncident(mon.incident, message)
+	} else {
+		err = mon.config.StatusBackend.UpdateIncident(mon.incident, message)
+	}
+
+	if err != nil {
+		l.Printf("Error sending incident update: %v", err)
+	}
+
+	mon.incident.failReason = mon.lastFailReason
 }
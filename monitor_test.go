@@ -1,7 +1,253 @@
 package cachet
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 )
 
-func TestAnalyseData(t *testing.T) {}
+// recordingBackend is a StatusBackend recording incident actions
+type recordingBackend struct {
+	mu      sync.Mutex
+	actions []string
+	metrics map[int][]float64
+	// failOpen is the number of OpenIncident calls to fail
+	failOpen int
+}
+
+func (b *recordingBackend) record(action string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.actions = append(b.actions, action)
+}
+
+func (b *recordingBackend) Ping() error { return nil }
+
+func (b *recordingBackend) OpenIncident(incident *Incident) error {
+	if b.failOpen > 0 {
+		b.failOpen--
+		b.record("open failed")
+		return errors.New("connection refused")
+	}
+
+	incident.ID = 1
+	b.record("open")
+	return nil
+}
+
+func (b *recordingBackend) UpdateIncident(incident *Incident, message string) error {
+	b.record(fmt.Sprintf("update %d", incident.Status))
+	return nil
+}
+
+func (b *recordingBackend) ResolveIncident(incident *Incident, message string) error {
+	b.record("resolve")
+	return nil
+}
+
+func (b *recordingBackend) GetComponent(id int) (Component, error) {
+	return Component{ID: id, Name: "component"}, nil
+}
+
+func (b *recordingBackend) SetComponentStatus(id int, status int) error {
+	b.record(fmt.Sprintf("component %d", status))
+	return nil
+}
+
+func (b *recordingBackend) SendMetric(id int, value float64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.metrics == nil {
+		b.metrics = map[int][]float64{}
+	}
+	b.metrics[id] = append(b.metrics[id], value)
+	return nil
+}
+
+// scriptedMonitor returns scripted check results, an empty fail reason is up
+type scriptedMonitor struct {
+	AbstractMonitor
+	results []string
+}
+
+func (monitor *scriptedMonitor) test() bool {
+	reason := monitor.results[0]
+	monitor.results = monitor.results[1:]
+	if len(reason) == 0 {
+		return true
+	}
+
+	monitor.setFailReason(FailUnknown, reason)
+	return false
+}
+
+func newScriptedMonitor(backend StatusBackend, results ...string) *scriptedMonitor {
+	monitor := &scriptedMonitor{results: results}
+	monitor.Name = "scripted"
+	monitor.ComponentID = 1
+	monitor.Threshold = 3
+	monitor.ThresholdCount = true
+	monitor.config = &CachetMonitor{StatusBackend: backend, DateFormat: DefaultTimeFormat}
+
+	return monitor
+}
+
+func TestAnalyseData(t *testing.T) {
+	const up, down = "", "down"
+
+	tests := []struct {
+		name    string
+		results []string
+		status  int
+		actions []string
+	}{
+		{"up", []string{up, up, up}, 0, nil},
+		{"not saturated", []string{down, down}, 0, nil},
+		{"below threshold", []string{down, down, up, down}, 0, nil},
+		{"investigating", []string{down, down, down}, 1, []string{"open"}},
+		{"investigating, fail reason changed", []string{down, down, down, "timeout"}, 1, []string{"open", "update 1"}},
+		{"investigating to identified", []string{down, down, down, down, down, down}, 2, []string{"open", "update 2"}},
+		{"investigating to watching", []string{down, down, down, up}, 3, []string{"open", "update 3"}},
+		{"identified to watching", []string{down, down, down, down, down, down, up}, 3, []string{"open", "update 2", "update 3"}},
+		{"watching to identified", []string{down, down, down, up, down, down, down}, 2, []string{"open", "update 3", "update 2"}},
+		{"watching to fixed", []string{down, down, down, up, up, up}, 0, []string{"open", "update 3", "resolve"}},
+		{"up after fixed", []string{down, down, down, up, up, up, up}, 0, []string{"open", "update 3", "resolve"}},
+		{"reopened after fixed", []string{down, down, down, up, up, up, down, down, down}, 1, []string{"open", "update 3", "resolve", "open"}},
+	}
+
+	for _, test := range tests {
+		backend := &recordingBackend{}
+		monitor := newScriptedMonitor(backend, test.results...)
+		for range test.results {
+			monitor.tick(monitor)
+		}
+
+		status := 0
+		if monitor.incident != nil {
+			status = monitor.incident.Status
+		}
+
+		if status != test.status {
+			t.Errorf("%s: expected incident status %d, got %d", test.name, test.status, status)
+		}
+
+		if !reflect.DeepEqual(backend.actions, test.actions) {
+			t.Errorf("%s: expected actions %v, got %v", test.name, test.actions, backend.actions)
+		}
+	}
+}
+
+func TestAnalyseDataOpenFailure(t *testing.T) {
+	const up, down = "", "down"
+
+	tests := []struct {
+		name     string
+		results  []string
+		failOpen int
+		status   int
+		actions  []string
+	}{
+		{"retried", []string{down, down, down, down}, 1, 1, []string{"open failed", "open"}},
+		{"retried, then identified", []string{down, down, down, down, down, down}, 2, 2, []string{"open failed", "open failed", "open", "update 2"}},
+		{"recovered before created", []string{down, down, down, up, up, up}, 5, 0, []string{"open failed", "open failed", "open failed"}},
+	}
+
+	for _, test := range tests {
+		backend := &recordingBackend{failOpen: test.failOpen}
+		monitor := newScriptedMonitor(backend, test.results...)
+		for range test.results {
+			monitor.tick(monitor)
+		}
+
+		status := 0
+		if monitor.incident != nil {
+			status = monitor.incident.Status
+		}
+
+		if status != test.status {
+			t.Errorf("%s: expected incident status %d, got %d", test.name, test.status, status)
+		}
+
+		if !reflect.DeepEqual(backend.actions, test.actions) {
+			t.Errorf("%s: expected actions %v, got %v", test.name, test.actions, backend.actions)
+		}
+	}
+}
+
+func TestClockStopDuringCheck(t *testing.T) {
+	backend := &recordingBackend{}
+	monitor := &blockingMonitor{started: make(chan bool), release: make(chan bool)}
+	monitor.Name = "slow"
+	monitor.ComponentID = 1
+	monitor.Threshold = 1
+	monitor.ThresholdCount = true
+	monitor.config = &CachetMonitor{StatusBackend: backend, DateFormat: DefaultTimeFormat}
+
+	done := make(chan bool)
+	tick := func() {
+		monitor.tick(monitor)
+		done <- true
+	}
+
+	// opens the incident
+	go tick()
+	<-monitor.started
+	monitor.release <- true
+	<-done
+
+	go tick()
+	<-monitor.started
+	monitor.ClockStop()
+	monitor.ResolveIncident()
+	close(monitor.release)
+	<-done
+
+	expected := []string{"open", "resolve"}
+	if !reflect.DeepEqual(backend.actions, expected) || monitor.incident != nil {
+		t.Errorf("expected the check to be ignored once stopped, got %v", backend.actions)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(`{"queue": 42}`))
+	}))
+	defer server.Close()
+
+	backend := &recordingBackend{}
+	monitor := &HTTPMonitor{}
+	monitor.Name = "check"
+	monitor.Target = server.URL
+	monitor.ComponentID = 1
+	monitor.MetricID = 1
+	monitor.ExpectedStatusCode = 200
+	monitor.Metrics = []HTTPMetric{{Extractor: Extractor{JSONPath: "$.queue"}, MetricID: 2}}
+	monitor.config = &CachetMonitor{StatusBackend: backend, DateFormat: DefaultTimeFormat}
+	if errs := monitor.Validate(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	result := Check(monitor)
+	if !result.Up || len(result.FailReason) > 0 || result.Metrics[2] != 42 {
+		t.Errorf("expected up with metric 2 = 42, got %+v", result)
+	}
+
+	status = http.StatusServiceUnavailable
+	result = Check(monitor)
+	if result.Up || !strings.Contains(result.FailReason, "503") {
+		t.Errorf("expected down with status code fail reason, got %+v", result)
+	}
+
+	if len(monitor.history) > 0 || len(backend.actions) > 0 || len(backend.metrics) > 0 {
+		t.Errorf("checks should not be recorded or sent, got history %v, actions %v, metrics %v", monitor.history, backend.actions, backend.metrics)
+	}
+}
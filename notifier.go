@@ -0,0 +1,143 @@
+package cachet
+
+import (
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// incident transitions sent to notifiers
+const (
+	EventOpen     = "open"
+	EventEscalate = "escalate"
+	EventResolve  = "resolve"
+)
+
+// Default notification template
+var defaultNotificationTpl = MessageTemplate{
+	Subject: `[{{ upper .Event }}] {{ .Monitor.Name }} - {{ .SystemName }}`,
+	Message: `{{ if eq .Event "resolve" }}{{ .Monitor.Name }} is back up{{ if .Duration }} after {{ humanize .Duration }}{{ end }}.{{ else }}{{ .Monitor.Name }} check **failed** (server time: {{ .now }})
+
+{{ .FailReason }}{{ end }}`,
+}
+
+// NotifierInterface receives incident transitions of the monitors routed to it
+type NotifierInterface interface {
+	Validate() []string
+	GetNotifier() *AbstractNotifier
+	Send(Notification) error
+}
+
+// Notification of an incident transition, rendered from the notifier's template
+type Notification struct {
+	Event      string `json:"event"`
+	Monitor    string `json:"monitor"`
+	SystemName string `json:"system_name"`
+	Subject    string `json:"subject"`
+	Message    string `json:"message"`
+	FailReason string `json:"fail_reason,omitempty"`
+	IncidentID int    `json:"incident_id,omitempty"`
+}
+
+// AbstractNotifier data model
+type AbstractNotifier struct {
+	Name string
+
+	// webhook / slack / email
+	Type string
+
+	Template MessageTemplate
+
+	config *CachetMonitor
+	// location in the configuration, eg. notifiers[2]
+	configPath string
+}
+
+func (notifier *AbstractNotifier) Validate() []string {
+	errs := []string{}
+
+	if len(notifier.Name) == 0 {
+		errs = append(errs, "Name is required")
+	}
+
+	notifier.Template.SetDefault(defaultNotificationTpl)
+	if err := notifier.Template.Compile(notifier.config, "notifiers."+notifier.Name); err != nil {
+		errs = append(errs, "Could not compile template: "+err.Error())
+		return errs
+	}
+
+	if notifier.config != nil {
+		data := getSampleTemplateData(&AbstractMonitor{Name: "Sample monitor", config: notifier.config})
+		data["Event"] = EventOpen
+
+		if err := notifier.Template.Test(data); err != nil {
+			errs = append(errs, "Could not render template with sample data: "+err.Error())
+		}
+	}
+
+	return errs
+}
+
+func (notifier *AbstractNotifier) GetNotifier() *AbstractNotifier {
+	return notifier
+}
+
+func GetNotifierType(t string) string {
+	return strings.ToLower(t)
+}
+
+// findNotifier returns the notifier named name, or nil
+func (cfg *CachetMonitor) findNotifier(name string) NotifierInterface {
+	for _, notifier := range cfg.Notifiers {
+		if notifier.GetNotifier().Name == name {
+			return notifier
+		}
+	}
+
+	return nil
+}
+
+// notify renders and sends event to the monitor's notifiers (all notifiers when none are configured)
+func (mon *AbstractMonitor) notify(event string) {
+	notifiers := mon.config.Notifiers
+	if len(mon.Notifiers) > 0 {
+		notifiers = []NotifierInterface{}
+		for _, name := range mon.Notifiers {
+			if notifier := mon.config.findNotifier(name); notifier != nil {
+				notifiers = append(notifiers, notifier)
+			}
+		}
+	}
+
+	if len(notifiers) == 0 {
+		return
+	}
+
+	data := getTemplateData(mon)
+	data["Event"] = event
+
+	for _, notifier := range notifiers {
+		n := Notification{
+			Event:      event,
+			Monitor:    mon.Name,
+			SystemName: mon.config.SystemName,
+			FailReason: mon.lastFailReason,
+		}
+		if mon.incident != nil {
+			n.IncidentID = mon.incident.ID
+		}
+
+		n.Subject, n.Message = notifier.GetNotifier().Template.Exec(data)
+
+		if mon.config.DryRun {
+			logrus.Infof("[dry run] notifier %v: %v - %v", notifier.GetNotifier().Name, n.Subject, n.Message)
+			continue
+		}
+
+		go func(notifier NotifierInterface, n Notification) {
+			if err := notifier.Send(n); err != nil {
+				logrus.Warnf("Notifier %v failed to send %v notification: %v", notifier.GetNotifier().Name, n.Event, err)
+			}
+		}(notifier, n)
+	}
+}
@@ -0,0 +1,73 @@
+package cachet
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// ProxyConfig routes requests through a HTTP, HTTPS or SOCKS5 proxy
+type ProxyConfig struct {
+	// URL is http://, https:// or socks5://host:port, credentials can be part of the url
+	URL      string `mapstructure:"url" json:"url" yaml:"url"`
+	Username string `mapstructure:"username" json:"username" yaml:"username"`
+	// Password can be a secret reference (file:...)
+	Password string `mapstructure:"password" json:"password" yaml:"password"`
+	// NoProxy lists hosts connected to directly: host names (also matching subdomains), .domain suffixes,
+	// ip addresses and cidr ranges, optionally with a port
+	NoProxy []string `mapstructure:"no_proxy" json:"no_proxy" yaml:"no_proxy"`
+}
+
+// ProxyFunc returns the proxy function of the transport, file: passwords are resolved against dir. Without a
+// configured proxy the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables are used, like
+// http.DefaultTransport does.
+func (c *ProxyConfig) ProxyFunc(dir string) (func(*http.Request) (*url.URL, error), error) {
+	if c == nil || len(c.URL) == 0 {
+		if c != nil && (len(c.Username) > 0 || len(c.NoProxy) > 0) {
+			return nil, errors.New("proxy: url missing")
+		}
+
+		proxy := httpproxy.FromEnvironment().ProxyFunc()
+		return func(req *http.Request) (*url.URL, error) {
+			return proxy(req.URL)
+		}, nil
+	}
+
+	proxyURL, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, errors.New("proxy: " + err.Error())
+	}
+
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+		break
+	default:
+		return nil, errors.New("proxy: unsupported scheme '" + proxyURL.Scheme + "', expected http, https or socks5")
+	}
+
+	if len(proxyURL.Host) == 0 {
+		return nil, errors.New("proxy: host missing in " + c.URL)
+	}
+
+	if len(c.Username) > 0 {
+		password, err := resolveSecret(dir, c.Password)
+		if err != nil {
+			return nil, errors.New("proxy password: " + err.Error())
+		}
+
+		proxyURL.User = url.UserPassword(c.Username, password)
+	}
+
+	proxy := (&httpproxy.Config{
+		HTTPProxy:  proxyURL.String(),
+		HTTPSProxy: proxyURL.String(),
+		NoProxy:    strings.Join(c.NoProxy, ","),
+	}).ProxyFunc()
+
+	return func(req *http.Request) (*url.URL, error) {
+		return proxy(req.URL)
+	}, nil
+}
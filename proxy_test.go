@@ -0,0 +1,104 @@
+package cachet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestHTTPMonitorProxy(t *testing.T) {
+	proxied := []string{}
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ := parseProxyAuth(r.Header.Get("Proxy-Authorization"))
+		proxied = append(proxied, r.URL.String()+" "+user+":"+password)
+	}))
+	defer proxy.Close()
+
+	for _, noProxy := range [][]string{nil, {".test"}} {
+		monitor := &HTTPMonitor{}
+		monitor.Name = "proxy"
+		monitor.Target = "http://service.example.test/health"
+		monitor.Interval = 10
+		monitor.Timeout = 1
+		monitor.ComponentID = 1
+		monitor.ExpectedStatusCode = 200
+		monitor.Proxy = &ProxyConfig{URL: proxy.URL, Username: "monitor", Password: "secret", NoProxy: noProxy}
+		if errs := monitor.Validate(); len(errs) > 0 {
+			t.Fatal(errs)
+		}
+
+		if up := monitor.test(); up != (noProxy == nil) {
+			t.Errorf("no_proxy %v: expected up %v, got %v (%s)", noProxy, noProxy == nil, up, monitor.checkFailReason)
+		}
+	}
+
+	if len(proxied) != 1 || proxied[0] != "http://service.example.test/health monitor:secret" {
+		t.Errorf("Unexpected proxied requests: %v", proxied)
+	}
+}
+
+func TestProxyConfigErrors(t *testing.T) {
+	for _, config := range []ProxyConfig{
+		{URL: "ftp://proxy:21"},
+		{URL: "socks5://"},
+		{NoProxy: []string{"internal"}},
+	} {
+		if _, err := config.ProxyFunc(""); err == nil {
+			t.Errorf("Expected error for %+v", config)
+		}
+	}
+
+}
+
+func TestProxyFromEnvironment(t *testing.T) {
+	proxied := []string{}
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		w.Write([]byte(`{"data": {}}`))
+	}))
+	defer proxy.Close()
+
+	os.Setenv("HTTP_PROXY", proxy.URL)
+	os.Setenv("NO_PROXY", "direct.example.test")
+	defer os.Unsetenv("HTTP_PROXY")
+	defer os.Unsetenv("NO_PROXY")
+
+	// without a proxy block, monitors and the api client use the environment
+	monitor := &HTTPMonitor{}
+	monitor.Name = "proxy"
+	monitor.Target = "http://service.example.test/health"
+	monitor.Interval = 10
+	monitor.Timeout = 1
+	monitor.ComponentID = 1
+	monitor.ExpectedStatusCode = 200
+	if errs := monitor.Validate(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	if up := monitor.test(); !up {
+		t.Errorf("expected the check to be proxied, got %s", monitor.checkFailReason)
+	}
+
+	monitor.Target = "http://direct.example.test/health"
+	if up := monitor.test(); up {
+		t.Error("expected no_proxy hosts to be connected to directly")
+	}
+
+	api := CachetAPI{URL: "http://cachet.example.test/api/v1", Token: "token"}
+	if err := api.Ping(); err != nil {
+		t.Errorf("expected the api request to be proxied: %v", err)
+	}
+
+	expected := []string{"http://service.example.test/health", "http://cachet.example.test/api/v1/ping"}
+	if !reflect.DeepEqual(proxied, expected) {
+		t.Errorf("expected proxied requests %v, got %v", expected, proxied)
+	}
+}
+
+// parseProxyAuth decodes a basic Proxy-Authorization header
+func parseProxyAuth(auth string) (string, string, bool) {
+	req := &http.Request{Header: http.Header{"Authorization": {auth}}}
+	return req.BasicAuth()
+}
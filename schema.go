@@ -0,0 +1,159 @@
+package cachet
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// JSONSchema returns a JSON Schema of the configuration file, generated from the configuration and monitor structs
+func JSONSchema() map[string]interface{} {
+	schema := structSchema(reflect.TypeOf(CachetMonitor{}), "json")
+	properties := schema["properties"].(map[string]interface{})
+
+	monitorSchemas := typeSchemas(monitorPrototypes(), GetMonitorType(""))
+	for _, schema := range monitorSchemas {
+		// expanded on load, see expandTargets and discoverMonitors
+		monitorProperties := schema.(map[string]interface{})["properties"].(map[string]interface{})
+		monitorProperties["targets"] = map[string]interface{}{"type": "array"}
+		monitorProperties["matrix"] = map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": map[string]interface{}{"type": "array"},
+		}
+		monitorProperties["component_id"] = map[string]interface{}{"type": []string{"integer", "string"}}
+		monitorProperties["metric_id"] = map[string]interface{}{"type": []string{"integer", "string"}}
+		monitorProperties["discover"] = structSchema(reflect.TypeOf(DiscoveryConfig{}), "mapstructure")
+		// a profile name or a list of names, see extendNames
+		monitorProperties["extend"] = map[string]interface{}{
+			"oneOf": []interface{}{
+				map[string]interface{}{"type": "string"},
+				map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+			},
+		}
+	}
+
+	properties["monitors"] = map[string]interface{}{
+		"type":  "array",
+		"items": map[string]interface{}{"anyOf": monitorSchemas},
+	}
+	properties["notifiers"] = map[string]interface{}{
+		"type":  "array",
+		"items": map[string]interface{}{"anyOf": typeSchemas(notifierPrototypes(), "")},
+	}
+
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "cachet-monitor configuration"
+
+	return schema
+}
+
+func monitorPrototypes() map[string]interface{} {
+	prototypes := map[string]interface{}{}
+	for name, newMonitor := range MonitorTypes {
+		prototypes[name] = newMonitor()
+	}
+
+	return prototypes
+}
+
+func notifierPrototypes() map[string]interface{} {
+	prototypes := map[string]interface{}{}
+	for name, newNotifier := range NotifierTypes {
+		prototypes[name] = newNotifier()
+	}
+
+	return prototypes
+}
+
+// typeSchemas returns a schema per type, matched on the `type` key. `type` is optional for defaultType.
+func typeSchemas(prototypes map[string]interface{}, defaultType string) []interface{} {
+	names := []string{}
+	for name := range prototypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	schemas := []interface{}{}
+	for _, name := range names {
+		schema := structSchema(reflect.TypeOf(prototypes[name]).Elem(), "mapstructure")
+		schema["title"] = name
+		schema["properties"].(map[string]interface{})["type"] = map[string]interface{}{
+			"type": "string",
+			"enum": []string{name},
+		}
+
+		if name != defaultType {
+			schema["required"] = []string{"type"}
+		}
+
+		schemas = append(schemas, schema)
+	}
+
+	return schemas
+}
+
+// typeSchema maps a go type to a schema. tagKey selects the struct tag naming object keys
+func typeSchema(t reflect.Type, tagKey string) map[string]interface{} {
+	if t == reflect.TypeOf(time.Duration(0)) {
+		return map[string]interface{}{"type": "integer", "description": "seconds"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem(), tagKey)
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), tagKey)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem(), tagKey)}
+	case reflect.Struct:
+		return structSchema(t, tagKey)
+	}
+
+	// interface{}
+	return map[string]interface{}{}
+}
+
+// structSchema returns an object schema with a property per exported field
+func structSchema(t reflect.Type, tagKey string) map[string]interface{} {
+	properties := map[string]interface{}{}
+	addFields(properties, t, tagKey)
+
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
+
+func addFields(properties map[string]interface{}, t reflect.Type, tagKey string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get(tagKey), ",")
+		name := tag[0]
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && len(name) == 0 {
+			addFields(properties, field.Type, tagKey)
+			continue
+		}
+
+		if len(field.PkgPath) > 0 || name == "-" {
+			continue
+		}
+
+		if len(name) == 0 {
+			name = strings.ToLower(field.Name)
+		}
+
+		properties[name] = typeSchema(field.Type, tagKey)
+	}
+}
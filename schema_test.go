@@ -0,0 +1,20 @@
+package cachet
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJSONSchemaExtend(t *testing.T) {
+	data, err := json.Marshal(JSONSchema())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// extend is a name or a list of names
+	expected := `"extend":{"oneOf":[{"type":"string"},{"items":{"type":"string"},"type":"array"}]}`
+	if !strings.Contains(string(data), expected) {
+		t.Errorf("expected %s in the schema", expected)
+	}
+}
@@ -0,0 +1,39 @@
+package cachet
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// ServerConfig configures the optional http listener
+type ServerConfig struct {
+	// host:port to listen on, eg. 127.0.0.1:9090
+	Listen string `json:"listen" yaml:"listen"`
+
+	// Admin enables the admin api on /api/monitors
+	Admin bool `json:"admin" yaml:"admin"`
+	// Token, when set, is required as bearer token by the admin api
+	Token string `json:"token" yaml:"token"`
+
+	// Dashboard enables the html dashboard on /
+	Dashboard bool `json:"dashboard" yaml:"dashboard"`
+}
+
+// Serve listens on the configured address, serving prometheus metrics on /metrics,
+// the admin api on /api/monitors and the dashboard on / when enabled
+func (cfg *CachetMonitor) Serve() error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	if cfg.Server.Admin {
+		mux.HandleFunc("/api/monitors", cfg.adminHandler)
+		mux.HandleFunc("/api/monitors/", cfg.adminHandler)
+	}
+
+	if cfg.Server.Dashboard {
+		mux.HandleFunc("/", cfg.dashboardHandler)
+	}
+
+	return http.ListenAndServe(cfg.Server.Listen, mux)
+}
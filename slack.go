@@ -0,0 +1,56 @@
+package cachet
+
+import (
+	"encoding/json"
+)
+
+// SlackNotifier posts notifications to a slack compatible incoming webhook
+type SlackNotifier struct {
+	AbstractNotifier `mapstructure:",squash"`
+
+	URL       string
+	Channel   string
+	Username  string
+	IconEmoji string `mapstructure:"icon_emoji"`
+}
+
+func (notifier *SlackNotifier) Validate() []string {
+	errs := notifier.AbstractNotifier.Validate()
+
+	// webhook urls contain the credentials
+	url, err := resolveSecret(notifier.config.configDir(), notifier.URL)
+	if err != nil {
+		errs = append(errs, "URL: "+err.Error())
+	}
+	notifier.URL = url
+
+	if len(notifier.URL) == 0 {
+		errs = append(errs, "URL is required")
+	}
+
+	return errs
+}
+
+func (notifier *SlackNotifier) Send(n Notification) error {
+	color := "danger"
+	if n.Event == EventResolve {
+		color = "good"
+	}
+
+	jsonBytes, _ := json.Marshal(map[string]interface{}{
+		"channel":    notifier.Channel,
+		"username":   notifier.Username,
+		"icon_emoji": notifier.IconEmoji,
+		"attachments": []map[string]interface{}{
+			{
+				"fallback":  n.Subject,
+				"color":     color,
+				"title":     n.Subject,
+				"text":      n.Message,
+				"mrkdwn_in": []string{"text"},
+			},
+		},
+	})
+
+	return postJSON(notifier.URL, nil, jsonBytes)
+}
@@ -2,52 +2,274 @@ package cachet
 
 import (
 	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
 	"text/template"
+	"time"
+
+	"github.com/Sirupsen/logrus"
 )
 
+// templateFuncs are helpers available in every template
+var templateFuncs = template.FuncMap{
+	"formatTime": formatTime,
+	"humanize":   humanizeDuration,
+	"truncate":   truncate,
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+}
+
 type MessageTemplate struct {
 	Subject string `json:"subject"`
 	Message string `json:"message"`
 
+	// read subject/message from files instead
+	SubjectFile string `json:"subject_file" yaml:"subject_file" mapstructure:"subject_file"`
+	MessageFile string `json:"message_file" yaml:"message_file" mapstructure:"message_file"`
+
+	// name of a shared template (CachetMonitor.Templates)
+	Use string `json:"use"`
+
+	defaults   *MessageTemplate
 	subjectTpl *template.Template
 	messageTpl *template.Template
+
+	// compiled defaults, used when executing the configured template fails
+	defaultSubjectTpl *template.Template
+	defaultMessageTpl *template.Template
 }
 
+// SetDefault sets the template used for subject/message when not configured otherwise
 func (t *MessageTemplate) SetDefault(d MessageTemplate) {
-	if len(t.Subject) == 0 {
-		t.Subject = d.Subject
-	}
-	if len(t.Message) == 0 {
-		t.Message = d.Message
-	}
+	t.defaults = &d
 }
 
 // TODO: test
-func (t *MessageTemplate) Compile() error {
+// Compile resolves subject/message from (in order) inline text, files, the shared template and defaults.
+// name identifies inline templates in compile errors, file templates are identified by path.
+func (t *MessageTemplate) Compile(cfg *CachetMonitor, name string) error {
+	var base *template.Template
+	sources := []MessageTemplate{*t}
+	dir := cfg.configDir()
+
+	if cfg != nil {
+		base = cfg.sharedTpl
+	}
+
+	if len(t.Use) > 0 {
+		var shared MessageTemplate
+		ok := false
+		if cfg != nil {
+			shared, ok = cfg.Templates[t.Use]
+		}
+
+		if !ok {
+			return fmt.Errorf("Shared template %q is not defined", t.Use)
+		}
+
+		sources = append(sources, shared)
+	}
+
+	if t.defaults != nil {
+		sources = append(sources, *t.defaults)
+	}
+
 	var err error
+	for _, src := range sources {
+		if t.subjectTpl != nil {
+			break
+		}
 
-	if len(t.Subject) > 0 {
-		t.subjectTpl, err = compileTemplate(t.Subject)
+		t.subjectTpl, err = src.compile(base, dir, src.Subject, src.SubjectFile, name+".subject")
+		if err != nil {
+			return err
+		}
 	}
 
-	if err == nil && len(t.Message) > 0 {
-		t.messageTpl, err = compileTemplate(t.Message)
+	for _, src := range sources {
+		if t.messageTpl != nil {
+			break
+		}
+
+		t.messageTpl, err = src.compile(base, dir, src.Message, src.MessageFile, name+".message")
+		if err != nil {
+			return err
+		}
 	}
 
-	return err
+	if t.defaults != nil {
+		if t.defaultSubjectTpl, err = compileTemplate(nil, name+".subject (default)", t.defaults.Subject); err != nil {
+			return err
+		}
+		if t.defaultMessageTpl, err = compileTemplate(nil, name+".message (default)", t.defaults.Message); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// compile parses inline text, or the contents of file (relative to dir). Returns nil when both are empty.
+func (t MessageTemplate) compile(base *template.Template, dir, text, file, name string) (*template.Template, error) {
+	if len(text) == 0 && len(file) > 0 {
+		data, err := ioutil.ReadFile(joinPath(dir, file))
+		if err != nil {
+			return nil, err
+		}
+
+		text = string(data)
+		name = file
+	}
+
+	if len(text) == 0 {
+		return nil, nil
+	}
+
+	return compileTemplate(base, name, text)
 }
 
+// Exec renders subject and message. If rendering fails, the error is logged and the default template is used.
 func (t *MessageTemplate) Exec(data interface{}) (string, string) {
-	return t.exec(t.subjectTpl, data), t.exec(t.messageTpl, data)
+	return t.exec(t.subjectTpl, t.defaultSubjectTpl, data), t.exec(t.messageTpl, t.defaultMessageTpl, data)
 }
 
-func (t *MessageTemplate) exec(tpl *template.Template, data interface{}) string {
+func (t *MessageTemplate) exec(tpl *template.Template, fallback *template.Template, data interface{}) string {
+	if tpl == nil {
+		tpl, fallback = fallback, nil
+	}
+
+	if tpl == nil {
+		return ""
+	}
+
 	buf := new(bytes.Buffer)
+	if err := tpl.Execute(buf, data); err != nil {
+		logrus.Warnf("Could not execute template: %v", err)
+
+		if fallback == nil {
+			return ""
+		}
+
+		logrus.Warnf("Falling back to the default template")
+		return t.exec(fallback, nil, data)
+	}
 
-	tpl.Execute(buf, data)
 	return buf.String()
 }
 
-func compileTemplate(text string) (*template.Template, error) {
-	return template.New("").Parse(text)
+// Test renders the compiled templates against data, failing on missing map keys as well as missing fields
+func (t *MessageTemplate) Test(data interface{}) error {
+	for _, tpl := range []*template.Template{t.subjectTpl, t.messageTpl} {
+		if tpl == nil {
+			continue
+		}
+
+		strict, err := tpl.Clone()
+		if err != nil {
+			return err
+		}
+
+		if err := strict.Option("missingkey=error").Execute(ioutil.Discard, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// compileTemplate parses text, with access to the templates defined in base
+func compileTemplate(base *template.Template, name, text string) (*template.Template, error) {
+	if base == nil {
+		return template.New(name).Funcs(templateFuncs).Parse(text)
+	}
+
+	tpl, err := base.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	return tpl.New(name).Parse(text)
+}
+
+// compileTemplateFiles parses files matching patterns (relative to dir) into a single set, so their
+// {{ define }} blocks can be used from any template
+func compileTemplateFiles(dir string, patterns []string) (*template.Template, error) {
+	set := template.New("").Funcs(templateFuncs)
+
+	for _, pattern := range patterns {
+		files, err := filepath.Glob(joinPath(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+
+		if len(files) == 0 {
+			return nil, fmt.Errorf("No template files match %q", pattern)
+		}
+
+		for _, file := range files {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+
+			if _, err := set.New(file).Parse(string(data)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return set, nil
+}
+
+// formatTime formats t using a go time layout, eg. {{ formatTime "15:04" .IncidentStarted }}
+func formatTime(layout string, t time.Time) string {
+	return t.Format(layout)
+}
+
+// humanizeDuration returns a rounded, human readable duration, eg. "2h 5m"
+func humanizeDuration(d time.Duration) string {
+	if d < time.Second {
+		return "0s"
+	}
+
+	d = d.Round(time.Second)
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	hours := d / time.Hour
+	d -= hours * time.Hour
+	minutes := d / time.Minute
+	d -= minutes * time.Minute
+	seconds := d / time.Second
+
+	parts := []string{}
+	if days > 0 {
+		parts = append(parts, fmt.Sprintf("%dd", days))
+	}
+	if hours > 0 {
+		parts = append(parts, fmt.Sprintf("%dh", hours))
+	}
+	if minutes > 0 {
+		parts = append(parts, fmt.Sprintf("%dm", minutes))
+	}
+	if seconds > 0 && days == 0 {
+		parts = append(parts, fmt.Sprintf("%ds", seconds))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// truncate shortens s to at most length characters, appending "..." when cut
+func truncate(length int, s string) string {
+	runes := []rune(s)
+	if len(runes) <= length {
+		return s
+	}
+
+	if length <= 3 {
+		return string(runes[:length])
+	}
+
+	return string(runes[:length-3]) + "..."
 }
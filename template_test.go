@@ -0,0 +1,57 @@
+package cachet
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHumanizeDuration(t *testing.T) {
+	cases := map[time.Duration]string{
+		0:                                     "0s",
+		45 * time.Second:                      "45s",
+		2*time.Hour + 5*time.Minute:           "2h 5m",
+		26*time.Hour + 3*time.Second:          "1d 2h",
+		90*time.Second + 400*time.Millisecond: "1m 30s",
+	}
+
+	for d, expected := range cases {
+		if h := humanizeDuration(d); h != expected {
+			t.Errorf("humanize(%v) = %q, expected %q", d, h, expected)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if s := truncate(10, "short"); s != "short" {
+		t.Errorf("short string should not be truncated, got %q", s)
+	}
+
+	if s := truncate(8, "connection refused"); s != "conne..." {
+		t.Errorf("expected truncated string, got %q", s)
+	}
+}
+
+func TestMessageTemplateFallback(t *testing.T) {
+	tpl := MessageTemplate{Subject: "{{ .Monitor.Nmae }}", Message: "{{ .FailReason }}"}
+	tpl.SetDefault(MessageTemplate{Subject: "{{ .Monitor.Name }}"})
+	if err := tpl.Compile(nil, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	data := map[string]interface{}{
+		"Monitor":    &AbstractMonitor{Name: "google"},
+		"FailReason": "timeout",
+	}
+
+	if err := tpl.Test(data); err == nil {
+		t.Error("expected missing field to fail validation")
+	}
+
+	subject, message := tpl.Exec(data)
+	if subject != "google" {
+		t.Errorf("expected fallback to default subject, got %q", subject)
+	}
+	if message != "timeout" {
+		t.Errorf("unexpected message %q", message)
+	}
+}
@@ -0,0 +1,73 @@
+package cachet
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// tlsVersions are the accepted min_tls_version values
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSConfig configures TLS connections: a private CA, a client certificate (mutual TLS), the server name to
+// verify and the minimum TLS version
+type TLSConfig struct {
+	// CAFile holds PEM certificates trusted instead of the system roots
+	CAFile     string `mapstructure:"ca_file" json:"ca_file" yaml:"ca_file"`
+	ClientCert string `mapstructure:"client_cert" json:"client_cert" yaml:"client_cert"`
+	ClientKey  string `mapstructure:"client_key" json:"client_key" yaml:"client_key"`
+	ServerName string `mapstructure:"server_name" json:"server_name" yaml:"server_name"`
+	// MinTLSVersion is 1.0, 1.1, 1.2 or 1.3
+	MinTLSVersion string `mapstructure:"min_tls_version" json:"min_tls_version" yaml:"min_tls_version"`
+}
+
+// Build returns the tls configuration, loading the CA and client certificate files (relative to dir)
+func (c TLSConfig) Build(dir string, insecure bool) (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: insecure,
+		ServerName:         c.ServerName,
+	}
+
+	if len(c.CAFile) > 0 {
+		pem, err := ioutil.ReadFile(joinPath(dir, c.CAFile))
+		if err != nil {
+			return nil, fmt.Errorf("Cannot read ca_file: %v", err)
+		}
+
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in ca_file %s", c.CAFile)
+		}
+	}
+
+	if len(c.ClientCert) > 0 || len(c.ClientKey) > 0 {
+		if len(c.ClientCert) == 0 || len(c.ClientKey) == 0 {
+			return nil, errors.New("client_cert and client_key must be set together")
+		}
+
+		cert, err := tls.LoadX509KeyPair(joinPath(dir, c.ClientCert), joinPath(dir, c.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("Cannot load client certificate: %v", err)
+		}
+
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(c.MinTLSVersion) > 0 {
+		version, ok := tlsVersions[c.MinTLSVersion]
+		if !ok {
+			return nil, fmt.Errorf("Unsupported min_tls_version %s, use 1.0, 1.1, 1.2 or 1.3", c.MinTLSVersion)
+		}
+
+		config.MinVersion = version
+	}
+
+	return config, nil
+}
@@ -0,0 +1,201 @@
+package cachet
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCA writes the certificate of server to a temporary file
+func writeCA(t *testing.T, server *httptest.Server) string {
+	ca, err := ioutil.TempFile("", "ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pem.Encode(ca, &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	ca.Close()
+
+	return ca.Name()
+}
+
+// writeClientCert writes a self signed client certificate and its key to dir
+func writeClientCert(t *testing.T, dir string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "cachet-monitor"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "client.pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "client.key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert
+}
+
+func TestHTTPMonitorCAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	ca := writeCA(t, server)
+	defer os.Remove(ca)
+
+	tests := []struct {
+		caFile   string
+		strict   bool
+		expected bool
+	}{
+		{"", true, false},
+		{ca, true, true},
+		// ca_file implies verification
+		{ca, false, true},
+		{"", false, true},
+	}
+
+	for _, test := range tests {
+		monitor := &HTTPMonitor{}
+		monitor.Name = "tls"
+		monitor.Target = server.URL
+		monitor.Strict = test.strict
+		monitor.Interval = 10
+		monitor.Timeout = 5
+		monitor.ComponentID = 1
+		monitor.ExpectedStatusCode = 200
+		monitor.CAFile = test.caFile
+		monitor.MinTLSVersion = "1.2"
+		if errs := monitor.Validate(); len(errs) > 0 {
+			t.Fatal(errs)
+		}
+
+		if up := monitor.test(); up != test.expected {
+			t.Errorf("%+v: expected up %v, got %v (%s)", test, test.expected, up, monitor.checkFailReason)
+		}
+
+		verify := test.strict || len(test.caFile) > 0
+		if monitor.transport.TLSClientConfig.InsecureSkipVerify == verify {
+			t.Errorf("%+v: expected certificates to be verified: %v", test, verify)
+		}
+
+		// checks share the transport built on validation
+		if client := newHTTPClient(&monitor.AbstractMonitor, &monitor.HTTPClientConfig); client.Transport != monitor.transport {
+			t.Errorf("%+v: expected the transport to be reused", test)
+		}
+	}
+}
+
+func TestHTTPMonitorClientCert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cachet-monitor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(writeClientCert(t, dir))
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	ca := writeCA(t, server)
+	defer os.Remove(ca)
+
+	for _, withCert := range []bool{true, false} {
+		monitor := &HTTPMonitor{}
+		monitor.Name = "mtls"
+		monitor.Target = server.URL
+		monitor.Strict = true
+		monitor.Interval = 10
+		monitor.Timeout = 5
+		monitor.ComponentID = 1
+		monitor.ExpectedStatusCode = 200
+		monitor.CAFile = ca
+		if withCert {
+			monitor.ClientCert = filepath.Join(dir, "client.pem")
+			monitor.ClientKey = filepath.Join(dir, "client.key")
+		}
+		if errs := monitor.Validate(); len(errs) > 0 {
+			t.Fatal(errs)
+		}
+
+		if up := monitor.test(); up != withCert {
+			t.Errorf("client certificate %v: expected up %v, got %v (%s)", withCert, withCert, up, monitor.checkFailReason)
+		}
+	}
+}
+
+func TestCachetAPICAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": {}}`))
+	}))
+	defer server.Close()
+
+	ca := writeCA(t, server)
+	defer os.Remove(ca)
+
+	api := CachetAPI{URL: server.URL, Token: "token"}
+	if err := api.Ping(); err == nil {
+		t.Error("expected the unknown certificate to be rejected")
+	}
+
+	api.CAFile = ca
+	client, err := api.httpClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.CloseIdleConnections()
+
+	if transport := client.Transport.(*http.Transport); transport.TLSClientConfig.InsecureSkipVerify || transport.TLSClientConfig.RootCAs == nil {
+		t.Error("expected certificates to be verified against ca_file")
+	}
+
+	api.client = client
+	if err := api.Ping(); err != nil {
+		t.Errorf("expected the certificate to be trusted with ca_file: %v", err)
+	}
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	for _, c := range []TLSConfig{{ClientCert: "cert.pem"}, {MinTLSVersion: "1.4"}, {CAFile: "/nonexistent"}} {
+		if _, err := c.Build("", false); err == nil {
+			t.Errorf("%+v should not build", c)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package cachet
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// WebhookNotifier posts notifications as JSON to URL
+type WebhookNotifier struct {
+	AbstractNotifier `mapstructure:",squash"`
+
+	URL     string
+	Headers map[string]string
+}
+
+func (notifier *WebhookNotifier) Validate() []string {
+	errs := notifier.AbstractNotifier.Validate()
+	errs = append(errs, resolveSecrets(notifier.config.configDir(), notifier.Headers)...)
+
+	if len(notifier.URL) == 0 {
+		errs = append(errs, "URL is required")
+	}
+
+	return errs
+}
+
+func (notifier *WebhookNotifier) Send(n Notification) error {
+	jsonBytes, _ := json.Marshal(n)
+
+	return postJSON(notifier.URL, notifier.Headers, jsonBytes)
+}
+
+// postJSON posts body to url, failing on non-2xx responses
+func postJSON(url string, headers map[string]string, body []byte) error {
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Received status code %d", resp.StatusCode)
+	}
+
+	return nil
+}